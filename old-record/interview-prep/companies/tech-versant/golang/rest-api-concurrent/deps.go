@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"taskkit/etag"
+	"taskkit/validate"
+)
+
+// ─── TASK DEPENDENCIES (DAG) ───
+//
+// A task may list tasks in dependsOn that have to complete before it runs:
+//
+//	pending, waiting ──(every dependency completed)──► queued as usual
+//	pending, waiting ──(a dependency failed, timed out or was cancelled)──► cancelled
+//
+// Waiting tasks are stored but not queued, and the scheduler holds back
+// a waiting task whose runAt comes due. transitionIf calls
+// settleDependents after every status change, which queues or cancels
+// the dependents of that task; a cancel settles its own dependents, so
+// failure cascades down the graph. Dependencies are set on create, or
+// replaced with PUT /api/tasks/{id}/dependencies while the task still
+// waits, and a change that would close a cycle is refused with 409.
+//
+// When the last two dependencies of a task complete at the same moment
+// it can be queued twice; the second copy is dropped by the worker's
+// pending → processing transition, like a task cancelled while queued.
+
+var (
+	errDependencyCycle = errors.New("dependency cycle")
+	errDependencyEnded = errors.New("dependency can no longer complete")
+)
+
+// depsMu orders "save a task, then look at its dependencies" against
+// settleDependents, so a dependency finishing in between is never missed.
+var depsMu sync.Mutex
+
+// waitState reports whether t still waits on a dependency. broken
+// describes the first dependency that will never complete ("" if none);
+// such a task is waiting too, until it is cancelled.
+func waitState(repo TaskRepository, t Task) (waiting bool, broken string) {
+	for _, id := range t.DependsOn {
+		d, ok := repo.Get(taskKey(t.ProjectID, id))
+		switch {
+		case !ok:
+			return true, "dependency " + id + " no longer exists"
+		case d.trashed():
+			return true, "dependency " + id + " is in the trash"
+		case d.Status == StatusCompleted:
+		case isTerminal(d.Status):
+			return true, "dependency " + id + " " + d.Status
+		default:
+			waiting = true
+		}
+	}
+	return waiting, ""
+}
+
+// checkDependencies dedupes t.DependsOn and checks it: every ID must be
+// a task the caller can see (400), none may have ended without
+// completing, and the edges must not close a cycle (409).
+func checkDependencies(ctx context.Context, repo TaskRepository, t *Task) (int, error) {
+	var deps []string
+	var errs validate.Errors
+	for _, id := range t.DependsOn {
+		id = strings.TrimSpace(id)
+		if slices.Contains(deps, id) {
+			continue
+		}
+		deps = append(deps, id)
+		if _, ok := getVisible(ctx, id); !ok && id != t.ID {
+			errs.Add("dependsOn", "unknown task "+id)
+		}
+	}
+	t.DependsOn = deps
+	if len(errs) > 0 {
+		return http.StatusBadRequest, errs
+	}
+	if cycle := findCycle(repo, t.ProjectID, t.ID, t.DependsOn); cycle != nil {
+		return http.StatusConflict, fmt.Errorf("%w: %s", errDependencyCycle, strings.Join(cycle, " → "))
+	}
+	if _, broken := waitState(repo, *t); broken != "" {
+		return http.StatusConflict, fmt.Errorf("%w: %s", errDependencyEnded, broken)
+	}
+	return 0, nil
+}
+
+// findCycle looks for a path from deps back to id along the stored
+// dependsOn edges of project pid and returns it as id → … → id, or nil.
+func findCycle(repo TaskRepository, pid, id string, deps []string) []string {
+	visited := make(map[string]bool)
+	var walk func(path, next []string) []string
+	walk = func(path, next []string) []string {
+		for _, d := range next {
+			if d == id {
+				return append(slices.Clone(path), d)
+			}
+			if visited[d] {
+				continue
+			}
+			visited[d] = true
+			if t, ok := repo.Get(taskKey(pid, d)); ok {
+				if c := walk(append(path, d), t.DependsOn); c != nil {
+					return c
+				}
+			}
+		}
+		return nil
+	}
+	return walk([]string{id}, deps)
+}
+
+// ready reports whether a pending task can go to the workers now: no
+// dependency left to wait for and no runAt still ahead.
+func ready(repo TaskRepository, t Task) bool {
+	waiting, _ := waitState(repo, t)
+	return !waiting && (t.RunAt == nil || !t.RunAt.After(time.Now()))
+}
+
+// holdWaiting wraps the scheduler's release so a task whose runAt comes
+// due while it still waits on dependencies stays pending;
+// settleDependents queues it later.
+func holdWaiting(repo TaskRepository, release func(Task) bool) func(Task) bool {
+	return func(t Task) bool {
+		if waiting, _ := waitState(repo, t); waiting {
+			taskLog(t).Info("scheduler: task due but waiting on dependencies")
+			return true
+		}
+		return release(t)
+	}
+}
+
+// settleDependents runs after t reached a new status or went to the
+// trash. Once t completed, pending dependents that are now ready are
+// queued; once it ended any other way or was trashed, they are
+// cancelled, which settles their dependents in turn.
+func settleDependents(repo TaskRepository, t Task) {
+	if !isTerminal(t.Status) && !t.trashed() {
+		return
+	}
+	var cancel []string
+	var runnable []Task
+	depsMu.Lock()
+	for _, d := range repo.GetAll() {
+		if d.Status != StatusPending || d.ProjectID != t.ProjectID || !slices.Contains(d.DependsOn, t.ID) {
+			continue
+		}
+		if _, broken := waitState(repo, d); broken != "" {
+			cancel = append(cancel, d.key())
+		} else if ready(repo, d) {
+			runnable = append(runnable, d)
+		}
+	}
+	depsMu.Unlock()
+
+	// Queued outside depsMu: requeue enters intake, and submitTask takes
+	// the two in the opposite order.
+	for _, d := range runnable {
+		taskLog(d).Info("dependencies completed, queueing task")
+		if !requeue(context.Background(), d) {
+			taskLog(d).Warn("could not queue task; it stays pending")
+		}
+	}
+
+	reason := "dependency " + t.ID + " " + t.Status
+	if t.trashed() {
+		reason = "dependency " + t.ID + " is in the trash"
+	}
+	for _, key := range cancel {
+		cancelDependent(repo, key, reason)
+	}
+}
+
+// cancelDependent cancels the pending task stored under key because a
+// dependency ended without completing.
+func cancelDependent(repo TaskRepository, key, reason string) {
+	t, err := transition(repo, key, StatusCancelled, func(t *Task) { t.LastError = reason })
+	switch {
+	case errors.Is(err, ErrInvalidTransition):
+		// already running or finished on its own
+	case err != nil:
+		taskLog(t).Error("cancelling dependent", "err", err)
+	default:
+		taskLog(t).Info("task cancelled", "reason", reason)
+	}
+}
+
+// ─── HANDLERS ───
+
+// updateDependencies is PUT /api/tasks/{id}/dependencies with body
+// {"dependsOn": [...]}. Only a task still waiting on its dependencies can
+// change them; If-Match is honoured (412).
+func updateDependencies(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		DependsOn []string `json:"dependsOn" validate:"max=50"`
+	}
+	err := validate.WithRules(validate.DecodeJSON(w, r, &body), func() error { return validate.Struct(&body, false).Err() })
+	if err != nil {
+		validate.WriteDecodeError(w, err)
+		return
+	}
+
+	depsMu.Lock()
+	t, status, err := replaceDependencies(r, body.DependsOn)
+	depsMu.Unlock()
+	switch {
+	case status == http.StatusBadRequest:
+		validate.WriteDecodeError(w, err)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if ready(store, t) && !requeue(r.Context(), t) {
+		taskLog(t).Warn("could not queue task; it stays pending")
+	}
+	w.Header().Set("ETag", etag.Of(t.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// replaceDependencies is the checked save behind updateDependencies; the
+// caller holds depsMu. On error the int is the HTTP status to report.
+func replaceDependencies(r *http.Request, deps []string) (Task, int, error) {
+	t, ok := getVisible(r.Context(), r.PathValue("id"))
+	if !ok {
+		return t, http.StatusNotFound, errors.New("not found")
+	}
+	if !etag.IfMatch(r, t.Version) {
+		return t, http.StatusPreconditionFailed, errors.New("If-Match does not match the current ETag " + etag.Of(t.Version))
+	}
+	if waiting, _ := waitState(store, t); t.Status != StatusPending || !waiting {
+		return t, http.StatusConflict, errors.New("dependencies can only change while the task waits on them")
+	}
+	version := t.Version
+	t.DependsOn = deps
+	if status, err := checkDependencies(r.Context(), store, &t); err != nil {
+		return t, status, err
+	}
+	saved, err := withActor(store, actorFrom(r.Context())).CompareAndSwap(t, version)
+	if errors.Is(err, ErrVersionConflict) {
+		return t, http.StatusConflict, err
+	}
+	if err != nil {
+		logFrom(r.Context()).Error("saving task", "task_id", t.ID, "err", err)
+		return t, http.StatusInternalServerError, errors.New("could not save task")
+	}
+	return saved, http.StatusOK, nil
+}
+
+type graphNode struct {
+	ID        string   `json:"id"`
+	Title     string   `json:"title"`
+	Status    string   `json:"status"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+	Waiting   bool     `json:"waiting,omitempty"` // pending on an unfinished dependency
+}
+
+type graphEdge struct {
+	From string `json:"from"` // the dependency
+	To   string `json:"to"`   // the task that waits on it
+}
+
+// getTaskGraph is GET /api/tasks/{id}/graph: the task plus everything it
+// depends on and everything that depends on it, transitively. Tasks the
+// caller can't see are left out, along with whatever is only reachable
+// through them. Edges never leave the root's project.
+func getTaskGraph(w http.ResponseWriter, r *http.Request) {
+	root, ok := getVisible(r.Context(), r.PathValue("id"))
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	all := make(map[string]Task)
+	down := make(map[string][]string) // id → its dependents
+	for _, t := range store.GetAll() {
+		if t.ProjectID != root.ProjectID {
+			continue
+		}
+		all[t.ID] = t
+		for _, d := range t.DependsOn {
+			down[d] = append(down[d], t.ID)
+		}
+	}
+
+	in := map[string]bool{root.ID: true}
+	walk := func(next func(string) []string) {
+		for queue := []string{root.ID}; len(queue) > 0; queue = queue[1:] {
+			for _, n := range next(queue[0]) {
+				if t, ok := all[n]; ok && !in[n] && canAccess(r.Context(), t) && !t.trashed() {
+					in[n] = true
+					queue = append(queue, n)
+				}
+			}
+		}
+	}
+	walk(func(id string) []string { return all[id].DependsOn })
+	walk(func(id string) []string { return down[id] })
+
+	nodes := make([]graphNode, 0, len(in))
+	edges := []graphEdge{}
+	for _, id := range slices.Sorted(maps.Keys(in)) {
+		t := all[id]
+		n := graphNode{ID: t.ID, Title: t.Title, Status: t.Status, DependsOn: t.DependsOn}
+		if t.Status == StatusPending {
+			n.Waiting, _ = waitState(store, t)
+		}
+		nodes = append(nodes, n)
+		for _, d := range t.DependsOn {
+			if in[d] {
+				edges = append(edges, graphEdge{From: d, To: t.ID})
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"root": root.ID, "nodes": nodes, "edges": edges})
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ─── CHANGE EVENTS ───
+//
+// publishingRepo wraps whichever TaskRepository backend is selected and
+// publishes every successful Set/Delete to the broker, so handlers,
+// workers and the scheduler all emit events without knowing about it.
+// The trash is hidden from events like from every other view: moving a
+// task there publishes "deleted", writes while it is there publish
+// nothing, and restoring it publishes "updated" again.
+
+type TaskEvent struct {
+	ID   uint64    `json:"id"`
+	Type string    `json:"type"` // "updated" | "deleted" | "reminder" (due soon, see reminders.go)
+	Task Task      `json:"task"`
+	At   time.Time `json:"at"`
+}
+
+type publishingRepo struct {
+	TaskRepository
+	broker *Broker
+}
+
+// Set is last-write-wins like the backends' Set, but goes through
+// CompareAndSwap so the event carries the version that was stored.
+func (r publishingRepo) Set(t Task) error {
+	for {
+		cur, _ := r.TaskRepository.Get(t.key())
+		_, err := r.CompareAndSwap(t, cur.Version)
+		if !errors.Is(err, ErrVersionConflict) {
+			return err
+		}
+	}
+}
+
+func (r publishingRepo) CompareAndSwap(t Task, version int64) (Task, error) {
+	prev, _ := r.TaskRepository.Get(t.key())
+	t, err := r.TaskRepository.CompareAndSwap(t, version)
+	if err != nil {
+		return t, err
+	}
+	switch {
+	case !t.trashed():
+		r.broker.Publish("updated", t)
+	case !prev.trashed():
+		r.broker.Publish("deleted", t)
+	}
+	return t, nil
+}
+
+func (r publishingRepo) Delete(key string) error {
+	t, _ := r.TaskRepository.Get(key)
+	if err := r.TaskRepository.Delete(key); err != nil {
+		return err
+	}
+	if !t.trashed() { // already announced when it was trashed
+		r.broker.Publish("deleted", t)
+	}
+	return nil
+}
+
+// ─── BROKER (fan-out + bounded history) ───
+//
+// Every subscriber gets its own buffered channel. A subscriber that falls
+// a full buffer behind is dropped rather than slowing down publishers
+// (workers); it can reconnect with Last-Event-ID and replay the gap from
+// history, as long as the gap is still in the ring buffer.
+
+var eventHistory = flag.Int("event-history", 1000, "events kept for Last-Event-ID resumption")
+
+const subscriberBuffer = 64
+
+type Broker struct {
+	mu      sync.Mutex
+	nextID  uint64
+	history []TaskEvent // ring buffer, oldest first once full
+	start   int
+	subs    map[chan TaskEvent]struct{}
+	closed  bool
+}
+
+var broker *Broker
+
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		history: make([]TaskEvent, 0, max(historySize, 1)),
+		subs:    make(map[chan TaskEvent]struct{}),
+	}
+}
+
+func (b *Broker) Publish(typ string, t Task) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	b.nextID++
+	ev := TaskEvent{ID: b.nextID, Type: typ, Task: t, At: time.Now()}
+	if len(b.history) < cap(b.history) {
+		b.history = append(b.history, ev)
+	} else {
+		b.history[b.start] = ev
+		b.start = (b.start + 1) % len(b.history)
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default: // too slow: drop it
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers a listener and atomically returns the history
+// after lastID, so nothing falls between replay and live events. gap is
+// true when events after lastID have already left the ring buffer.
+func (b *Broker) Subscribe(lastID uint64) (ch chan TaskEvent, replay []TaskEvent, gap bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch = make(chan TaskEvent, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return ch, nil, false
+	}
+	b.subs[ch] = struct{}{}
+
+	if lastID == 0 {
+		return ch, nil, false
+	}
+	for i := range b.history {
+		ev := b.history[(b.start+i)%len(b.history)]
+		if ev.ID > lastID {
+			replay = append(replay, ev)
+		}
+	}
+	oldest := b.nextID - uint64(len(b.history)) + 1
+	gap = lastID+1 < oldest
+	return ch, replay, gap
+}
+
+func (b *Broker) Unsubscribe(ch chan TaskEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// Close ends every stream; used on server shutdown.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// ─── SSE HANDLER ───
+
+// streamTaskEvents serves GET /api/tasks/events as Server-Sent Events.
+// Optional filters: ?id=<task id>, ?status=<status>. Resume with the
+// Last-Event-ID header (or ?lastEventId= for clients that can't set it).
+func streamTaskEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	idFilter := r.URL.Query().Get("id")
+	statusFilter := r.URL.Query().Get("status")
+	if statusFilter != "" && !validStatuses[statusFilter] {
+		http.Error(w, "unknown status", http.StatusBadRequest)
+		return
+	}
+
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("lastEventId")
+	}
+	var lastID uint64
+	if last != "" {
+		n, err := strconv.ParseUint(last, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = n
+	}
+
+	ch, replay, gap := broker.Subscribe(lastID)
+	defer broker.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(ev TaskEvent) {
+		if !canAccess(r.Context(), ev.Task) {
+			return
+		}
+		if idFilter != "" && ev.Task.ID != idFilter {
+			return
+		}
+		if statusFilter != "" && ev.Task.Status != statusFilter {
+			return
+		}
+		data, _ := json.Marshal(ev)
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	}
+
+	if gap {
+		// some events are gone; tell the client to refetch the list
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, ev := range replay {
+		send(ev)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return // dropped as too slow, or shutting down
+			}
+			send(ev)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ─── AUDIT HISTORY ───
+//
+// auditRepo is the outermost TaskRepository wrapper: every Set,
+// CompareAndSwap and Delete is recorded as an immutable HistoryEntry with
+// who made it, when, and the fields that changed. Writes and their
+// entries are serialised by one lock, so each diff is against exactly the
+// previous version. The actor comes from the repo value itself:
+//
+//	withActor(store, actorFrom(ctx))          handlers   source "api"
+//	withActor(store, Actor{Source: "worker"}) workers    source "worker"
+//	store                                     scheduler, recovery, purger: "system"
+//
+// Changes made as a consequence (cascading cancels, see deps.go) are
+// recorded with the actor of the write that caused them.
+//
+// GET /api/tasks/{id}/history lists the entries; with ?at=<RFC 3339> it
+// replays them instead and answers the task as it was at that moment.
+// Entries are appended to -history as JSON lines. Once a task is
+// deleted for good (purged from the trash, or with its project) its
+// entries are dropped from memory, and purgeLoop compacts them out of
+// the file.
+
+var historyPath = flag.String("history", "", "file to append task history to (default: <data>.history with the json/log store)")
+
+const (
+	SourceAPI    = "api"
+	SourceWorker = "worker"
+	SourceSystem = "system"
+)
+
+// Actor is who made a change.
+type Actor struct {
+	Source    string `json:"source"`              // "api" | "worker" | "system"
+	UserID    string `json:"userId,omitempty"`    // the caller, for "api"
+	RequestID string `json:"requestId,omitempty"` // X-Request-ID, for "api"
+	Worker    int    `json:"worker,omitempty"`    // for "worker"
+}
+
+func actorFrom(ctx context.Context) Actor {
+	u, _ := UserFrom(ctx)
+	return Actor{Source: SourceAPI, UserID: u.ID, RequestID: RequestIDFrom(ctx)}
+}
+
+type HistoryEntry struct {
+	TaskID    string      `json:"taskId"`
+	ProjectID string      `json:"projectId,omitempty"`
+	Version   int64       `json:"version"` // the task's version after the change; 0 for "deleted"
+	At        time.Time   `json:"at"`      // the task's updatedAt after the change
+	Op        string      `json:"op"`      // "created" | "updated" | "deleted" | "baseline" (state before history was kept)
+	Actor     Actor       `json:"actor"`
+	Changes   []FieldDiff `json:"changes,omitempty"`
+}
+
+// FieldDiff is one changed JSON field; a missing from/to means unset.
+type FieldDiff struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from,omitempty"`
+	To    json.RawMessage `json:"to,omitempty"`
+}
+
+// diffTasks lists the JSON fields that differ between a and b. version
+// and updatedAt change on every write and are carried by the entry.
+func diffTasks(a, b *Task) []FieldDiff {
+	fa, fb := taskFields(a), taskFields(b)
+	union := maps.Clone(fa)
+	maps.Copy(union, fb)
+	var out []FieldDiff
+	for _, k := range slices.Sorted(maps.Keys(union)) {
+		if k == "version" || k == "updatedAt" || bytes.Equal(fa[k], fb[k]) {
+			continue
+		}
+		out = append(out, FieldDiff{Field: k, From: fa[k], To: fb[k]})
+	}
+	return out
+}
+
+func taskFields(t *Task) map[string]json.RawMessage {
+	m := map[string]json.RawMessage{}
+	if t != nil {
+		data, _ := json.Marshal(t)
+		json.Unmarshal(data, &m)
+	}
+	return m
+}
+
+// ─── HISTORY STORE ───
+
+var history *History
+
+type History struct {
+	write sync.Mutex // held across a task write and its entry, see auditRepo
+
+	mu     sync.RWMutex
+	byTask map[string][]HistoryEntry // by task key
+	file   *os.File                  // nil: memory only
+	path   string
+	dead   int // entries in the file of deleted tasks, see Compact
+}
+
+func OpenHistory(path string) (*History, error) {
+	h := &History{byTask: make(map[string][]HistoryEntry), path: path}
+	if path == "" {
+		return h, nil
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e HistoryEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			// a torn last line from a crash; later appends start a new line
+			slog.Warn("history: skipping unreadable entry", "path", path, "err", err)
+			continue
+		}
+		h.add(e)
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	h.file = f
+	if err := h.Compact(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// add indexes e; a "deleted" entry drops the task's entries instead.
+// The caller holds mu or owns h.
+func (h *History) add(e HistoryEntry) {
+	if e.Op == "deleted" {
+		h.dead += len(h.byTask[e.key()]) + 1
+		delete(h.byTask, e.key())
+		return
+	}
+	h.byTask[e.key()] = append(h.byTask[e.key()], e)
+}
+
+func (h *History) append(e HistoryEntry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.add(e)
+	if h.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding history entry: %w", err)
+	}
+	// newline first, so an entry never continues a torn line
+	if _, err := h.file.Write(append([]byte("\n"), line...)); err != nil {
+		return fmt.Errorf("appending history: %w", err)
+	}
+	return h.file.Sync()
+}
+
+// key is the store key of the entry's task; see taskKey.
+func (e HistoryEntry) key() string { return taskKey(e.ProjectID, e.TaskID) }
+
+// For returns the entries of the task stored under key, oldest first.
+func (h *History) For(key string) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return slices.Clone(h.byTask[key])
+}
+
+// Has reports whether the task stored under key has any entries.
+func (h *History) Has(key string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.byTask[key]) > 0
+}
+
+// Compact rewrites the file without the entries of deleted tasks and
+// swaps it in, like the log backend in taskkit/storage. It does nothing
+// until a task has been deleted.
+func (h *History) Compact() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil || h.dead == 0 {
+		return nil
+	}
+	tmpPath := h.path + ".compact"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("compacting %s: %w", h.path, err)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, key := range slices.Sorted(maps.Keys(h.byTask)) {
+		for _, e := range h.byTask[key] {
+			if err := enc.Encode(e); err != nil {
+				tmp.Close()
+				os.Remove(tmpPath)
+				return fmt.Errorf("compacting %s: %w", h.path, err)
+			}
+		}
+	}
+	if err := w.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("compacting %s: %w", h.path, err)
+	}
+
+	if err := os.Rename(tmpPath, h.path); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("compacting %s: %w", h.path, err)
+	}
+	h.file.Close()
+	h.file = tmp // already positioned at the end
+	h.dead = 0
+	return nil
+}
+
+func (h *History) Close() error {
+	if h.file == nil {
+		return nil
+	}
+	return h.file.Close()
+}
+
+// asOf replays entries up to and including at. ok is false when the task
+// did not exist then.
+func asOf(entries []HistoryEntry, at time.Time) (t Task, ok bool) {
+	fields := map[string]json.RawMessage{}
+	var last *HistoryEntry
+	for i := range entries {
+		e := &entries[i]
+		if e.At.After(at) {
+			break
+		}
+		if e.Op == "deleted" {
+			fields, last = map[string]json.RawMessage{}, nil
+			continue
+		}
+		for _, d := range e.Changes {
+			if d.To == nil {
+				delete(fields, d.Field)
+			} else {
+				fields[d.Field] = d.To
+			}
+		}
+		last = e
+	}
+	if last == nil {
+		return t, false
+	}
+	data, _ := json.Marshal(fields)
+	json.Unmarshal(data, &t)
+	t.Version, t.UpdatedAt = last.Version, last.At
+	return t, true
+}
+
+// ─── RECORDING REPO ───
+
+type auditRepo struct {
+	TaskRepository
+	history *History
+	actor   Actor
+}
+
+// withActor returns repo with writes recorded as made by a. Repos that
+// don't record history are returned as they are.
+func withActor(repo TaskRepository, a Actor) TaskRepository {
+	if r, ok := repo.(auditRepo); ok {
+		r.actor = a
+		return r
+	}
+	return repo
+}
+
+func (r auditRepo) Set(t Task) error {
+	r.history.write.Lock()
+	defer r.history.write.Unlock()
+	prev, existed := r.TaskRepository.Get(t.key())
+	saved, err := r.TaskRepository.CompareAndSwap(t, prev.Version)
+	if err != nil {
+		return err
+	}
+	r.record(prev, existed, saved)
+	return nil
+}
+
+func (r auditRepo) CompareAndSwap(t Task, version int64) (Task, error) {
+	r.history.write.Lock()
+	defer r.history.write.Unlock()
+	prev, existed := r.TaskRepository.Get(t.key())
+	saved, err := r.TaskRepository.CompareAndSwap(t, version)
+	if err != nil {
+		return saved, err
+	}
+	r.record(prev, existed, saved)
+	return saved, nil
+}
+
+func (r auditRepo) Delete(key string) error {
+	r.history.write.Lock()
+	defer r.history.write.Unlock()
+	prev, _ := r.TaskRepository.Get(key)
+	if err := r.TaskRepository.Delete(key); err != nil {
+		return err
+	}
+	r.appendEntry(HistoryEntry{TaskID: prev.ID, ProjectID: prev.ProjectID, At: time.Now(), Op: "deleted", Actor: r.actor})
+	return nil
+}
+
+// record appends the entry for a write that turned prev into saved. A
+// task stored before history was kept first gets a baseline entry with
+// its state at that point, so replays start from the whole task.
+func (r auditRepo) record(prev Task, existed bool, saved Task) {
+	e := HistoryEntry{TaskID: saved.ID, ProjectID: saved.ProjectID, Version: saved.Version, At: saved.UpdatedAt, Op: "updated", Actor: r.actor}
+	switch {
+	case !existed:
+		e.Op = "created"
+		e.Changes = diffTasks(nil, &saved)
+	default:
+		if !r.history.Has(saved.key()) {
+			r.appendEntry(HistoryEntry{TaskID: prev.ID, ProjectID: prev.ProjectID, Version: prev.Version, At: prev.UpdatedAt, Op: "baseline",
+				Actor: Actor{Source: SourceSystem}, Changes: diffTasks(nil, &prev)})
+		}
+		e.Changes = diffTasks(&prev, &saved)
+	}
+	r.appendEntry(e)
+}
+
+func (r auditRepo) appendEntry(e HistoryEntry) {
+	// the write itself already happened; a lost entry is logged, not fatal
+	if err := r.history.append(e); err != nil {
+		slog.Error("history: recording change", "task_id", e.TaskID, "err", err)
+	}
+}
+
+func (r auditRepo) Close() error {
+	return errors.Join(r.TaskRepository.Close(), r.history.Close())
+}
+
+// ─── HANDLER ───
+
+// getTaskHistory is GET /api/tasks/{id}/history[?at=<RFC 3339>]. Trashed
+// tasks keep their history too.
+func getTaskHistory(w http.ResponseWriter, r *http.Request) {
+	t, ok := store.Get(taskKey(projectFrom(r.Context()), r.PathValue("id")))
+	if !ok || !canAccess(r.Context(), t) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var out any = history.For(t.key())
+	if at := r.URL.Query().Get("at"); at != "" {
+		when, err := time.Parse(time.RFC3339Nano, at)
+		if err != nil {
+			http.Error(w, "at must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		then, ok := asOf(history.For(t.key()), when)
+		if !ok {
+			http.Error(w, "task did not exist at "+at, http.StatusNotFound)
+			return
+		}
+		out = then
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
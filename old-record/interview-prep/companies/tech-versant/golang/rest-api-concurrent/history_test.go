@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryDropsPurgedTasks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.history")
+	h, err := OpenHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := auditRepo{TaskRepository: NewTaskStore(), history: h, actor: Actor{Source: SourceSystem}}
+	repo.Set(Task{ID: "kept", Title: "a"})
+	repo.Set(Task{ID: "gone", Title: "b"})
+	repo.Set(Task{ID: "gone", Title: "b2"})
+	if !h.Has("gone") || len(h.For("gone")) != 2 {
+		t.Fatalf("For(gone) = %v; want created and updated", h.For("gone"))
+	}
+
+	now := time.Now()
+	repo.Set(Task{ID: "gone", Title: "b2", DeletedAt: &now})
+	purgeTrash(repo, 0, now.Add(time.Second))
+	if h.Has("gone") {
+		t.Fatalf("a purged task keeps %d entries in memory", len(h.For("gone")))
+	}
+
+	before, _ := os.ReadFile(path)
+	if err := h.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.ReadFile(path)
+	if bytes.Contains(after, []byte(`"gone"`)) || len(after) >= len(before) {
+		t.Fatalf("compacted file still mentions the purged task:\n%s", after)
+	}
+
+	// appends after a compaction land in the new file
+	repo.Set(Task{ID: "kept", Title: "a2"})
+	h.Close()
+	if h, err = OpenHistory(path); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if got := h.For("kept"); len(got) != 2 || h.Has("gone") {
+		t.Fatalf("after reopen For(kept) = %v, Has(gone) = %v; want 2 entries and false", got, h.Has("gone"))
+	}
+}
+
+func TestOpenHistoryCompactsDeletedTasks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.history")
+	h, _ := OpenHistory(path)
+	repo := auditRepo{TaskRepository: NewTaskStore(), history: h, actor: Actor{Source: SourceSystem}}
+	repo.Set(Task{ID: "gone", Title: "b"})
+	repo.Delete("gone")
+	h.Close() // crashed before purgeLoop compacted
+
+	if h, _ = OpenHistory(path); h.Has("gone") {
+		t.Fatal("reopen kept the entries of a deleted task")
+	}
+	h.Close()
+	if data, _ := os.ReadFile(path); len(bytes.TrimSpace(data)) != 0 {
+		t.Fatalf("reopen left %q in the file; want it compacted away", data)
+	}
+}
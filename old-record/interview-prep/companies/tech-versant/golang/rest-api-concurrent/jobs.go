@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"taskkit/etag"
+)
+
+// ─── JOB FUNCTIONS ───
+//
+// A job gets a context that is cancelled by POST /api/tasks/{id}/cancel
+// or when the task's timeout elapses, and must return ctx.Err() promptly
+// when that happens.
+
+type jobFunc func(ctx context.Context, t Task) error
+
+var runJob jobFunc = runTyped // see jobtypes.go
+
+var failRate = flag.Float64("fail-rate", 0, "fraction of simulated jobs that fail (0..1), to exercise retries")
+
+// simulateWork stands in for real work of length d.
+func simulateWork(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if rand.Float64() < *failRate {
+		return errors.New("simulated failure")
+	}
+	return nil
+}
+
+// ─── RUNNING JOBS ───
+
+// runningJobs maps task key → cancel func of the job currently executing it.
+type runningJobs struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+var running = runningJobs{cancels: make(map[string]context.CancelFunc)}
+
+func (r *runningJobs) add(key string, cancel context.CancelFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancels[key] = cancel
+}
+
+func (r *runningJobs) remove(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cancels, key)
+}
+
+func (r *runningJobs) cancel(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cancel, ok := r.cancels[key]; ok {
+		cancel()
+	}
+}
+
+// jobContext derives the context for one run of t, honouring its timeout.
+func jobContext(t Task) (context.Context, context.CancelFunc) {
+	if d, _ := time.ParseDuration(t.Timeout); d > 0 {
+		return context.WithTimeout(context.Background(), d)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// ─── CANCEL HANDLER ───
+
+// cancelByID cancels the task stored under key before a worker takes it,
+// or signals the running job to stop. match, if set, is the caller's
+// If-Match check.
+func cancelByID(ctx context.Context, key string, match func(Task) bool) (Task, error) {
+	t, err := transitionIf(withActor(store, actorFrom(ctx)), key, match, StatusCancelled)
+	if err == nil {
+		running.cancel(key)
+	}
+	return t, err
+}
+
+// cancelTask is POST /api/tasks/{id}/cancel. Terminal tasks answer 409.
+func cancelTask(w http.ResponseWriter, r *http.Request) {
+	t, ok := getVisible(r.Context(), r.PathValue("id"))
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	t, err := cancelByID(r.Context(), t.key(), func(t Task) bool { return etag.IfMatch(r, t.Version) })
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrVersionConflict) && r.Header.Get("If-Match") != "":
+		http.Error(w, "If-Match does not match the current ETag "+etag.Of(t.Version), http.StatusPreconditionFailed)
+		return
+	case errors.Is(err, ErrVersionConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, ErrInvalidTransition):
+		http.Error(w, "task already "+t.Status, http.StatusConflict)
+		return
+	default:
+		http.Error(w, "could not cancel task", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag.Of(t.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"taskkit/validate"
+)
+
+// ─── JOB TYPE REGISTRY ───
+//
+// Every task names a job type. A type brings its own payload struct
+// (decoded strictly and validated on createTask) and a concurrency limit.
+// When a worker pulls a task whose type is already at its limit, the task
+// is parked on that type instead of blocking the worker; whichever worker
+// finishes a job of that type takes the parked task next. So a flood of
+// slow "report" jobs occupies at most its own slots and never starves
+// "email".
+
+const defaultJobType = "demo"
+
+// payload fields carry validate tags (see taskkit/validate); Validate is
+// for rules spanning several fields and runs after the tags pass.
+type payload interface {
+	Validate() error
+}
+
+type jobType struct {
+	name  string
+	check func(raw json.RawMessage) error
+	run   func(ctx context.Context, t Task) error
+	slots
+}
+
+var jobTypes = map[string]*jobType{}
+
+// register adds a job type whose payload decodes into P.
+func register[P payload](name string, limit int, run func(ctx context.Context, t Task, p P) error) {
+	jobTypes[name] = &jobType{
+		name:  name,
+		slots: slots{limit: limit},
+		check: func(raw json.RawMessage) error {
+			_, err := decodePayload[P](raw)
+			return err
+		},
+		run: func(ctx context.Context, t Task) error {
+			p, err := decodePayload[P](t.Payload)
+			if err != nil {
+				return err
+			}
+			return run(ctx, t, p)
+		},
+	}
+}
+
+func decodePayload[P payload](raw json.RawMessage) (P, error) {
+	var p P
+	if len(raw) == 0 {
+		raw = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return p, err
+	}
+	if errs := validate.Struct(&p, false); errs != nil {
+		return p, errs
+	}
+	return p, p.Validate()
+}
+
+// lookupJobType resolves t.Type; tasks persisted before types existed
+// have an empty type and run as the default.
+func lookupJobType(name string) (*jobType, bool) {
+	if name == "" {
+		name = defaultJobType
+	}
+	jt, ok := jobTypes[name]
+	return jt, ok
+}
+
+// slots is a concurrency limit that parks the overflow instead of
+// blocking a worker. Job types have one, and so do projects (see
+// projects.go).
+type slots struct {
+	mu     sync.Mutex
+	limit  int
+	active int
+	parked []Task
+}
+
+// acquire takes a slot for t, or parks t and reports false.
+func (s *slots) acquire(t Task) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active < s.limit {
+		s.active++
+		return true
+	}
+	s.parked = append(s.parked, t)
+	return false
+}
+
+// handoff passes the caller's slot to the next parked task, if any;
+// otherwise it frees the slot.
+func (s *slots) handoff() (Task, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.parked) > 0 {
+		t := s.parked[0]
+		s.parked = s.parked[1:]
+		return t, true
+	}
+	s.active--
+	return Task{}, false
+}
+
+func (s *slots) stats() (limit, active, parked int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit, s.active, len(s.parked)
+}
+
+// runTyped is the jobFunc the workers call.
+func runTyped(ctx context.Context, t Task) error {
+	jt, ok := lookupJobType(t.Type)
+	if !ok {
+		return fmt.Errorf("unknown job type %q", t.Type)
+	}
+	return jt.run(ctx, t)
+}
+
+// ─── LIMITS FLAG ───
+
+// -type-limits=report=1,email=2 overrides the registered defaults.
+var typeLimits = flag.String("type-limits", "", "per job type concurrency, e.g. report=1,email=2")
+
+func applyTypeLimits(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	for _, kv := range strings.Split(spec, ",") {
+		name, n, ok := strings.Cut(kv, "=")
+		limit, err := strconv.Atoi(n)
+		jt, known := jobTypes[name]
+		if !ok || err != nil || limit < 1 || !known {
+			return fmt.Errorf("bad -type-limits entry %q", kv)
+		}
+		jt.limit = limit
+	}
+	return nil
+}
+
+// ─── BUILT-IN TYPES ───
+
+type demoPayload struct{}
+
+func (demoPayload) Validate() error { return nil }
+
+type resizePayload struct {
+	URL    string `json:"url" validate:"required"`
+	Width  int    `json:"width" validate:"min=1"`
+	Height int    `json:"height" validate:"min=1"`
+}
+
+func (resizePayload) Validate() error { return nil }
+
+type emailPayload struct {
+	To      string `json:"to" validate:"email"`
+	Subject string `json:"subject" validate:"required,max=200"`
+	Body    string `json:"body"`
+}
+
+func (emailPayload) Validate() error { return nil }
+
+type reportPayload struct {
+	Name   string `json:"name" validate:"required"`
+	Format string `json:"format" validate:"oneof=csv|pdf"`
+}
+
+func (reportPayload) Validate() error { return nil }
+
+func init() {
+	register(defaultJobType, 3, func(ctx context.Context, t Task, p demoPayload) error {
+		return simulateWork(ctx, 2*time.Second)
+	})
+	register("resize", 2, func(ctx context.Context, t Task, p resizePayload) error {
+		return simulateWork(ctx, 1*time.Second)
+	})
+	register("email", 2, func(ctx context.Context, t Task, p emailPayload) error {
+		return simulateWork(ctx, 500*time.Millisecond)
+	})
+	register("report", 1, func(ctx context.Context, t Task, p reportPayload) error {
+		return simulateWork(ctx, 5*time.Second)
+	})
+}
+
+// ─── JOB TYPES HANDLER ───
+
+type jobTypeInfo struct {
+	Name   string `json:"name"`
+	Limit  int    `json:"limit"`
+	Active int    `json:"active"`
+	Parked int    `json:"parked"`
+}
+
+func getJobTypes(w http.ResponseWriter, r *http.Request) {
+	infos := make([]jobTypeInfo, 0, len(jobTypes))
+	for _, jt := range jobTypes {
+		limit, active, parked := jt.stats()
+		infos = append(infos, jobTypeInfo{jt.name, limit, active, parked})
+	}
+	slices.SortFunc(infos, func(a, b jobTypeInfo) int { return strings.Compare(a.Name, b.Name) })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+)
+
+// ─── INTAKE GATE ───
+//
+// createTask holds the read side while it enqueues; shutdown takes the
+// write side to flip closed, so once it returns no handler is mid-enqueue
+// and every later createTask answers 503.
+
+type intakeGate struct {
+	mu     sync.RWMutex
+	closed bool
+}
+
+var intake intakeGate
+
+// enter reports whether new work is still accepted. On true the caller
+// must call leave when done enqueueing.
+func (g *intakeGate) enter() bool {
+	g.mu.RLock()
+	if g.closed {
+		g.mu.RUnlock()
+		return false
+	}
+	return true
+}
+
+func (g *intakeGate) leave() { g.mu.RUnlock() }
+
+// close stops intake and closes the queue once in-flight enqueues
+// finish. The dispatcher drains what's queued, then closes jobs.
+func (g *intakeGate) close(q *taskQueue) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.closed {
+		g.closed = true
+		q.Close()
+	}
+}
+
+// ─── CRASH RECOVERY ───
+
+// recoverUnfinished re-queues tasks a previous run left pending or
+// processing (killed mid-job), oldest first. Pending tasks with a runAt
+// belong to the scheduler and are skipped, as are tasks still waiting on
+// dependencies; one whose dependency ended without completing while the
+// server was down is cancelled now. processing is reset to pending
+// because the work has to start over. Gives up when ctx is cancelled.
+func recoverUnfinished(ctx context.Context, store TaskRepository) int {
+	var unfinished []Task
+	for _, t := range store.GetAll() {
+		if t.Status == StatusPending && (t.RunAt != nil || t.trashed()) {
+			continue
+		}
+		if waiting, broken := waitState(store, t); t.Status == StatusPending && waiting {
+			if broken != "" {
+				cancelDependent(store, t.key(), broken)
+			}
+			continue
+		}
+		if t.Status == StatusPending || t.Status == StatusProcessing {
+			unfinished = append(unfinished, t)
+		}
+	}
+	slices.SortFunc(unfinished, func(a, b Task) int {
+		return cmp.Compare(a.CreatedAt.UnixNano(), b.CreatedAt.UnixNano())
+	})
+
+	for i, t := range unfinished {
+		if t.Status == StatusProcessing {
+			// deliberately outside the state machine: the run was lost
+			t.Status = StatusPending
+			if err := store.Set(t); err != nil {
+				taskLog(t).Error("recovery: saving task", "err", err)
+			}
+		}
+		if !requeue(ctx, t) {
+			return i
+		}
+	}
+	return len(unfinished)
+}
+
+// requeue puts back work the server already accepted (recovery, retries,
+// replays). It bypasses -queue-depth: these tasks are in the store
+// anyway, and rejecting them would only strand them as pending.
+func requeue(ctx context.Context, t Task) bool {
+	if ctx.Err() != nil || !intake.enter() {
+		return false
+	}
+	defer intake.leave()
+	if !queue.Push(t) {
+		return false
+	}
+	inFlight.add(t.key())
+	return true
+}
@@ -1,138 +1,498 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
+
+	"taskkit/etag"
+	"taskkit/idempotency"
+	"taskkit/ids"
+	"taskkit/validate"
 )
 
 // ─── MODEL ───
 
 type Task struct {
-	ID     string `json:"id"`
-	Title  string `json:"title"`
-	Done   bool   `json:"done"`
-	Status string `json:"status"` // "pending" | "processing" | "completed"
-}
-
-// ─── THREAD-SAFE STORE (sync.RWMutex) ───
-
-type TaskStore struct {
-	mu    sync.RWMutex
-	tasks map[string]Task
-}
-
-func NewTaskStore() *TaskStore {
-	return &TaskStore{tasks: make(map[string]Task)}
-}
-
-func (s *TaskStore) GetAll() []Task {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	result := make([]Task, 0, len(s.tasks))
-	for _, t := range s.tasks {
-		result = append(result, t)
-	}
-	return result
-}
-
-func (s *TaskStore) Get(id string) (Task, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	t, ok := s.tasks[id]
-	return t, ok
-}
-
-func (s *TaskStore) Set(t Task) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.tasks[t.ID] = t
+	ID         string          `json:"id" validate:"readonly"`
+	Title      string          `json:"title" validate:"required,max=200"`
+	Done       bool            `json:"done" validate:"readonly"`
+	Type       string          `json:"type"`                                     // job type, see jobtypes.go
+	Payload    json.RawMessage `json:"payload,omitempty"`                        // type-specific input
+	Status     string          `json:"status" validate:"readonly"`               // see status.go
+	Priority   int             `json:"priority" validate:"min=0,max=9"`          // higher runs first
+	Timeout    string          `json:"timeout,omitempty" validate:"duration"`    // per-run limit, e.g. "30s"; empty = none
+	RunAt      *time.Time      `json:"runAt,omitempty"`                          // delayed start, see scheduler.go
+	Tags       []string        `json:"tags,omitempty" validate:"max=20,tags"`    // indexed, see GET /api/tasks?tag=
+	DueAt      *time.Time      `json:"dueAt,omitempty"`                          // deadline, see reminders.go
+	DependsOn  []string        `json:"dependsOn,omitempty" validate:"max=50"`    // must complete first, see deps.go
+	ScheduleID string          `json:"scheduleId,omitempty" validate:"readonly"` // set on tasks a cron schedule created
+	ProjectID  string          `json:"projectId,omitempty" validate:"readonly"`  // "" = default project, see projects.go
+	DeletedAt  *time.Time      `json:"deletedAt,omitempty" validate:"readonly"`  // in the trash since, see trash.go
+	Attempts   int             `json:"attempts" validate:"readonly"`
+	LastError  string          `json:"lastError,omitempty" validate:"readonly"`
+	RequestID  string          `json:"requestId,omitempty" validate:"readonly"` // X-Request-ID of the creating request
+	OwnerID    string          `json:"ownerId" validate:"readonly"`             // set from the caller on create
+	CreatedAt  time.Time       `json:"createdAt" validate:"readonly"`           // set by the store on first write
+	UpdatedAt  time.Time       `json:"updatedAt" validate:"readonly"`           // set by the store on every write
+	Version    int64           `json:"version" validate:"readonly"`             // bumped by the store on every write, see taskkit/etag
 }
 
 // ─── BACKGROUND WORKER (goroutine + channel) ───
 
-func worker(id int, jobs <-chan Task, store *TaskStore, wg *sync.WaitGroup) {
+func worker(ctx context.Context, id int, jobs <-chan Task, store TaskRepository, wg *sync.WaitGroup) {
 	defer wg.Done()
-	for task := range jobs {
-		fmt.Printf("[Worker %d] Processing task: %s\n", id, task.Title)
+	poolWorkers.Add(1, "idle")
+	defer poolWorkers.Add(-1, "idle")
+	store = withActor(store, Actor{Source: SourceWorker, Worker: id})
+	for queued := range jobs {
+		if _, ok := lookupJobType(queued.Type); !ok {
+			// e.g. stored before its type was removed: it can never run,
+			// so fail it where GET /api/dead-letters shows it
+			inFlight.taken(queued.key())
+			notTrashed := func(t Task) bool { return !t.trashed() }
+			_, err := transitionIf(store, queued.key(), notTrashed, StatusFailed, func(t *Task) { t.LastError = "unknown job type" })
+			switch {
+			case err == nil:
+				taskLog(queued).Warn("task dead-lettered", "worker", id, "err", "unknown job type", "type", queued.Type)
+			case !errors.Is(err, ErrInvalidTransition) && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrVersionConflict):
+				taskLog(queued).Error("failing task of unknown job type", "worker", id, "type", queued.Type, "err", err)
+			}
+			continue
+		}
+		// At its project's quota: parked, a worker finishing a task of
+		// that project takes it on.
+		if !projectSlots(queued.ProjectID).acquire(queued) {
+			continue
+		}
+		for admitted := []Task{queued}; len(admitted) > 0; admitted = admitted[1:] {
+			// At the type's limit: parked, keeping its project slot, and a
+			// worker finishing that type runs it.
+			jt, _ := lookupJobType(admitted[0].Type)
+			if !jt.acquire(admitted[0]) {
+				continue
+			}
+			for t, more := admitted[0], true; more; t, more = jt.handoff() {
+				process(ctx, id, t, store)
+				if next, ok := projectSlots(t.ProjectID).handoff(); ok {
+					admitted = append(admitted, next)
+				}
+			}
+		}
+	}
+}
 
-		// Update status to processing
-		task.Status = "processing"
-		store.Set(task)
+// process runs one attempt of a queued task and records the outcome.
+func process(ctx context.Context, id int, queued Task, store TaskRepository) {
+	inFlight.taken(queued.key())
+	// Update status to processing (skips tasks cancelled, trashed or
+	// deleted while queued)
+	task, err := transitionIf(store, queued.key(), func(t Task) bool { return !t.trashed() }, StatusProcessing, func(t *Task) { t.Attempts++ })
+	if err != nil {
+		skipped := errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrNotFound) ||
+			errors.Is(err, ErrVersionConflict) && task.trashed()
+		if !skipped {
+			taskLog(queued).Error("starting task", "worker", id, "err", err)
+		}
+		return
+	}
+	log := taskLog(task).With("worker", id)
+	log.Info("processing task", "type", task.Type, "title", task.Title, "attempt", task.Attempts)
+	setWorkerBusy(true)
+	defer setWorkerBusy(false)
 
-		time.Sleep(2 * time.Second) // simulate work
+	start := time.Now()
+	jobCtx, cancel := jobContext(task)
+	running.add(task.key(), cancel)
+	err = runJob(jobCtx, task)
+	running.remove(task.key())
+	cancel()
+	observe := func(status string) { taskDuration.ObserveSince(start, task.Type, status) }
 
-		// Update status to completed
-		task.Status = "completed"
-		task.Done = true
-		store.Set(task)
+	var to string
+	switch {
+	case err == nil:
+		to = StatusCompleted
+	case errors.Is(err, context.DeadlineExceeded):
+		to = StatusTimedOut
+	case errors.Is(err, context.Canceled):
+		// cancelTask already moved it to cancelled
+		observe(StatusCancelled)
+		log.Info("task cancelled")
+		return
+	default:
+		status, err := handleJobError(ctx, store, task, err)
+		if err != nil {
+			log.Error("saving task", "err", err)
+			return
+		}
+		observe(status)
+		return
+	}
 
-		fmt.Printf("[Worker %d] Completed task: %s\n", id, task.Title)
+	if _, err := transition(store, task.key(), to); err != nil {
+		if errors.Is(err, ErrInvalidTransition) { // lost the race to a cancel
+			observe(StatusCancelled)
+		} else {
+			log.Error("saving task", "err", err)
+		}
+		return
 	}
+	observe(to)
+	log.Info("task finished", "status", to)
 }
 
 // ─── HANDLERS ───
 
-var store = NewTaskStore()
-var jobs = make(chan Task, 10) // buffered channel
+var store TaskRepository
+var jobs chan Task // unbuffered, fed by the priority dispatcher
+
+var queueDepth = flag.Int("queue-depth", 10, "how many tasks may wait in the queue")
+var spillPath = flag.String("spill", "", "spill overflow tasks to this file instead of rejecting with 429")
+var shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for in-flight requests and jobs on SIGINT/SIGTERM")
 
 func getTasks(w http.ResponseWriter, r *http.Request) {
+	q, err := parseTaskQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, next := q.apply(visibleTasks(r.Context(), q.candidates(store)))
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+		w.Header().Set("Link", "<"+nextLink(r.URL, next)+`>; rel="next"`)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(store.GetAll())
+	json.NewEncoder(w).Encode(page)
 }
 
 func getTaskByID(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	t, ok := store.Get(id)
+	t, ok := getVisible(r.Context(), r.PathValue("id"))
 	if !ok {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
+	w.Header().Set("ETag", etag.Of(t.Version))
+	if etag.NotModified(r, t.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(t)
 }
 
+// validateTask checks the Task's validate tags plus its job type and
+// payload, and fills defaults. create rejects server-maintained fields.
+func validateTask(t *Task, create bool) error {
+	t.Tags = validate.NormalizeTags(t.Tags)
+	errs := validate.Struct(t, create)
+	if t.Type == "" {
+		t.Type = defaultJobType
+	}
+	jt, ok := jobTypes[t.Type]
+	if !ok {
+		errs.Add("type", fmt.Sprintf("unknown job type %q", t.Type))
+	} else if err := jt.check(t.Payload); err != nil {
+		var perrs validate.Errors
+		if errors.As(err, &perrs) || errors.As(validate.JSONError(err), &perrs) {
+			errs = append(errs, perrs.Prefixed("payload")...)
+		} else {
+			errs.Add("payload", err.Error())
+		}
+	}
+	return errs.Err()
+}
+
+// submitTask validates, stores and queues a new task. On error the int
+// is the HTTP status to report. Shared by createTask and the WebSocket API.
+func submitTask(ctx context.Context, t Task) (Task, int, error) {
+	if !intake.enter() {
+		return t, http.StatusServiceUnavailable, errors.New("server is shutting down")
+	}
+	defer intake.leave()
+
+	if err := validateTask(&t, true); err != nil {
+		return t, http.StatusBadRequest, err
+	}
+	t.ID = ids.New()
+	t.Status = StatusPending
+	t.Attempts, t.LastError = 0, ""
+	t.ScheduleID = ""
+	t.RequestID = RequestIDFrom(ctx)
+	t.ProjectID = projectFrom(ctx)
+	u, _ := UserFrom(ctx)
+	t.OwnerID = u.ID
+	if t.RunAt != nil && !t.RunAt.After(time.Now()) {
+		t.RunAt = nil // already due
+	}
+	depsMu.Lock()
+	if status, err := checkDependencies(ctx, store, &t); err != nil {
+		depsMu.Unlock()
+		return t, status, err
+	}
+	repo := withActor(store, actorFrom(ctx))
+	t, err := repo.CompareAndSwap(t, 0)
+	waiting, _ := waitState(store, t)
+	depsMu.Unlock()
+	if err != nil {
+		logFrom(ctx).Error("saving task", "task_id", t.ID, "err", err)
+		return t, http.StatusInternalServerError, errors.New("could not save task")
+	}
+
+	// Delayed: the scheduler queues it at runAt
+	if t.RunAt != nil {
+		scheduler.AddTask(t)
+		return t, http.StatusCreated, nil
+	}
+
+	// Blocked: settleDependents queues it once its dependencies complete
+	if waiting {
+		return t, http.StatusCreated, nil
+	}
+
+	// Send to worker pool via channel (never blocks)
+	if err := enqueue(t); err != nil {
+		repo.Delete(t.key())
+		if errors.Is(err, errQueueFull) {
+			return t, http.StatusTooManyRequests, err
+		}
+		return t, http.StatusInternalServerError, errors.New("could not queue task")
+	}
+	return t, http.StatusCreated, nil
+}
+
 func createTask(w http.ResponseWriter, r *http.Request) {
 	var t Task
-	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+	err := validate.WithRules(validate.DecodeJSON(w, r, &t), func() error { return validateTask(&t, true) })
+	if err != nil {
+		validate.WriteDecodeError(w, err)
 		return
 	}
-	t.ID = fmt.Sprintf("%d", time.Now().UnixNano())
-	t.Status = "pending"
-	store.Set(t)
 
-	// Send to worker pool via channel
-	jobs <- t
+	t, status, err := submitTask(r.Context(), t)
+	if err != nil {
+		switch status {
+		case http.StatusBadRequest:
+			validate.WriteDecodeError(w, err)
+			return
+		case http.StatusServiceUnavailable:
+			w.Header().Set("Retry-After", "5")
+		case http.StatusTooManyRequests:
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
 
+	w.Header().Set("ETag", etag.Of(t.Version))
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(t)
 }
 
 // ─── MAIN ───
 
 func main() {
+	flag.Parse()
+	if err := setupLogging(*logFormat, *logLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var err error
+	store, err = openRepository(*storeKind, *storePath)
+	if err != nil {
+		slog.Error("startup", "err", err)
+		os.Exit(1)
+	}
+	broker = NewBroker(*eventHistory)
+	store = publishingRepo{TaskRepository: store, broker: broker}
+	if *historyPath == "" && *storeKind != "memory" {
+		*historyPath = *storePath + ".history"
+	}
+	history, err = OpenHistory(*historyPath)
+	if err != nil {
+		slog.Error("startup", "err", err)
+		os.Exit(1)
+	}
+	store = auditRepo{TaskRepository: store, history: history, actor: Actor{Source: SourceSystem}}
+	defer store.Close() // auditRepo.Close closes the history too
+
+	if err := setupAuth(*usersPath, *tokenSecret); err != nil {
+		slog.Error("startup", "err", err)
+		os.Exit(1)
+	}
+	limiter, err = newRateLimiter(*rateLimits)
+	if err != nil {
+		slog.Error("startup", "err", err)
+		os.Exit(1)
+	}
+	if err := applyTypeLimits(*typeLimits); err != nil {
+		slog.Error("startup", "err", err)
+		os.Exit(1)
+	}
+
+	if *schedulesPath == "" && *storeKind != "memory" {
+		*schedulesPath = *storePath + ".schedules"
+	}
+	schedules, err = OpenScheduleStore(*schedulesPath)
+	if err != nil {
+		slog.Error("startup", "err", err)
+		os.Exit(1)
+	}
+	if *projectsPath == "" && *storeKind != "memory" {
+		*projectsPath = *storePath + ".projects"
+	}
+	projects, err = OpenProjectStore(*projectsPath)
+	if err != nil {
+		slog.Error("startup", "err", err)
+		os.Exit(1)
+	}
+
+	queue = newTaskQueue(*queueDepth)
+	jobs = make(chan Task)
+	go queue.dispatch(jobs)
+	if *spillPath != "" {
+		spill, err = openSpillQueue(*spillPath)
+		if err != nil {
+			slog.Error("startup", "err", err)
+			os.Exit(1)
+		}
+		defer spill.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if limiter != nil {
+		go limiter.evictLoop(ctx, time.Minute)
+	}
+	go idempotency.EvictLoop(ctx, time.Minute)
+	if *remindBefore > 0 {
+		go remindLoop(ctx, store, *remindBefore, *remindEvery, func(t Task) {
+			taskLog(t).Info("task due soon", "due_at", t.DueAt)
+			broker.Publish("reminder", t)
+		})
+	}
+	if *trashRetention > 0 {
+		go purgeLoop(ctx, store, *trashRetention, *purgeEvery)
+	}
+
 	// Start 3 workers
 	var wg sync.WaitGroup
 	for i := 1; i <= 3; i++ {
 		wg.Add(1)
-		go worker(i, jobs, store, &wg)
+		go worker(ctx, i, jobs, store, &wg)
 	}
 
+	// Re-queue whatever the last run didn't finish.
+	go func() {
+		if n := recoverUnfinished(ctx, store); n > 0 {
+			slog.Info("re-queued unfinished tasks", "count", n)
+		}
+	}()
+	if spill != nil {
+		go feedFromSpill(ctx, spill)
+	}
+
+	scheduler = NewScheduler(realClock{}, store, schedules, holdWaiting(store, func(t Task) bool { return requeue(ctx, t) }))
+	go scheduler.Run(ctx)
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /api/tasks", getTasks)
-	mux.HandleFunc("GET /api/tasks/{id}", getTaskByID)
-	mux.HandleFunc("POST /api/tasks", createTask)
+	routes(mux)
+
+	srv := &http.Server{Addr: ":8080", Handler: chain(mux, requestID, accessLog, instrument(mux), rateLimit(limiter, mux), authenticate)}
+	srv.RegisterOnShutdown(broker.Close) // end SSE streams so Shutdown can finish
+
+	go func() {
+		slog.Info("server on :8080", "workers", 3, "store", *storeKind)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server stopped", "err", err)
+			stop()
+		}
+	}()
 
-	fmt.Println("Server on :8080 (3 workers running)")
-	http.ListenAndServe(":8080", mux)
+	<-ctx.Done()
+	stop() // a second Ctrl+C now kills the process immediately
+	slog.Info("shutting down: draining jobs")
 
-	// Cleanup (reached on shutdown)
-	close(jobs)
-	wg.Wait()
+	deadline, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	// 1. Stop HTTP: no new connections, wait for in-flight requests.
+	if err := srv.Shutdown(deadline); err != nil {
+		slog.Error("http shutdown", "err", err)
+	}
+
+	// 2. Stop intake and let workers drain the queued jobs.
+	intake.close(queue)
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		slog.Info("all jobs drained")
+	case <-deadline.Done():
+		// Unfinished tasks stay pending/processing in the store and are
+		// re-queued on the next start.
+		slog.Warn("shutdown deadline hit; unfinished tasks will resume on next start")
+	}
+}
+
+// idempotent makes a POST handler honour Idempotency-Key, keyed per user.
+var idempotent = idempotency.Middleware(func(r *http.Request) string {
+	u, _ := UserFrom(r.Context())
+	return u.ID
+})
+
+// routes registers every handler on mux; projects_test.go builds the
+// same mux.
+func routes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/tokens", issueToken)
+	mux.HandleFunc("GET /api/queue", getQueue)
+	mux.HandleFunc("GET /api/job-types", getJobTypes)
+	mux.HandleFunc("GET /api/projects", getProjects)
+	mux.HandleFunc("POST /api/projects", createProject)
+	mux.HandleFunc("GET /api/projects/{pid}", getProject)
+	mux.HandleFunc("POST /api/projects/{pid}/archive", archiveProject)
+	mux.HandleFunc("DELETE /api/projects/{pid}", deleteProject)
+	// Task-scoped routes: once for the default project, once per project.
+	for _, prefix := range []string{"/api", "/api/projects/{pid}"} {
+		scoped := func(method, path string, h http.Handler) {
+			mux.Handle(method+" "+prefix+path, inProject(h))
+		}
+		scoped("GET", "/ws", http.HandlerFunc(serveWebSocket))
+		scoped("GET", "/tasks", http.HandlerFunc(getTasks))
+		scoped("GET", "/tasks/{id}", http.HandlerFunc(getTaskByID))
+		scoped("GET", "/tasks/events", http.HandlerFunc(streamTaskEvents))
+		scoped("POST", "/tasks", idempotent(http.HandlerFunc(createTask)))
+		scoped("POST", "/tasks/{id}/cancel", http.HandlerFunc(cancelTask))
+		scoped("DELETE", "/tasks/{id}", http.HandlerFunc(deleteTask))
+		scoped("POST", "/tasks/{id}/restore", http.HandlerFunc(restoreTask))
+		scoped("GET", "/trash", http.HandlerFunc(getTrash))
+		scoped("GET", "/tasks/{id}/graph", http.HandlerFunc(getTaskGraph))
+		scoped("GET", "/tasks/{id}/history", http.HandlerFunc(getTaskHistory))
+		scoped("PUT", "/tasks/{id}/dependencies", http.HandlerFunc(updateDependencies))
+		scoped("GET", "/schedules", http.HandlerFunc(getSchedules))
+		scoped("POST", "/schedules", http.HandlerFunc(createSchedule))
+		scoped("GET", "/schedules/{id}", http.HandlerFunc(getSchedule))
+		scoped("PUT", "/schedules/{id}", http.HandlerFunc(updateSchedule))
+		scoped("DELETE", "/schedules/{id}", http.HandlerFunc(deleteSchedule))
+		scoped("GET", "/dead-letters", http.HandlerFunc(getDeadLetters))
+		scoped("POST", "/dead-letters/{id}/replay", http.HandlerFunc(replayDeadLetter))
+	}
+	mux.Handle("GET /metrics", registry)
 }
 
 // ─── WHAT TO NARRATE IN INTERVIEW ───
@@ -141,14 +501,62 @@ func main() {
 //  goroutines can read concurrently, Lock for writes which is exclusive.
 //  Always defer Unlock.
 //
-//  When a task is created, I send it to a buffered channel. 3 worker
-//  goroutines range over this channel and process tasks concurrently.
+//  When a task is created, I push it onto a bounded priority heap without
+//  blocking — if it's full the client gets 429 + Retry-After (or the task
+//  spills to disk with -spill) instead of hanging the handler. A
+//  dispatcher goroutine feeds the most urgent task (with aging, so low
+//  priorities don't starve) into a channel, and 3 worker goroutines
+//  range over it and process tasks concurrently.
 //  WaitGroup tracks when all workers finish.
 //
 //  The flow: POST creates task (pending) → channel → worker picks it up
 //  (processing) → worker completes it (completed). GET shows real-time
-//  status because the store is thread-safe."
+//  status because the store is thread-safe. Each job runs under a
+//  context; POST /cancel or the task's timeout cancels it, ending in
+//  cancelled / timed_out. Errors are retried with exponential backoff +
+//  jitter; after -max-attempts the task is failed (dead-lettered) and can
+//  be replayed. Each task has a type (resize/email/report/...) with its
+//  own payload schema and concurrency limit, so one slow type can't hog
+//  all the workers. Tasks can start later (runAt) or come from cron
+//  schedules; a scheduler goroutine sleeps on a min-heap of due times.
+//  Tasks can depend on others: they wait until those complete, and are
+//  cancelled down the graph when one fails.
+//  Tasks live in projects (/api/projects/{pid}/tasks), each capped at a
+//  share of the workers, so one tenant's flood can't starve the others.
+//  DELETE only moves a task to the trash; it can be restored until a
+//  purger goroutine removes it after the retention period.
+//  Every write goes through an audit wrapper around the store, so each
+//  task has a history of who changed which fields, API or worker.
+//  Every store write is published to a fan-out broker, so clients can
+//  watch status changes live over SSE instead of polling, or drive
+//  everything over one WebSocket (hand-rolled framing, no deps).
+//
+//  On SIGINT/SIGTERM I stop accepting POSTs (503), Shutdown the HTTP
+//  server, close the queue and let workers drain it within a
+//  deadline. Anything still pending/processing is re-queued next start."
 //
 // ─── TEST ───
-// Terminal 1: go run main.go
+// Terminal 1: go run .            (or: go run . -store=log -data=tasks.log)
+//             go run . -queue-depth=2 -spill=overflow.q   (see 429s / spilling)
+//             go run . -fail-rate=0.7 -retry-base=200ms    (see retries / dead letters)
+//             go run . -aging=0                           (strict priority, no aging)
+//             go run . -log-format=json -log-level=debug
+//             curl http://localhost:8080/metrics          (Prometheus text format)
+//             go run . -users=users.json -token-secret=change-me
+//             go run . -rate-limits="POST /api/tasks=3:0.5"   (see per-client 429s sooner)
+//             go run . -max-body=4096                     (413 for larger request bodies)
+//             go run . -idempotency-ttl=1m                (forget Idempotency-Keys sooner)
+//             go run . -remind-before=1h -remind-every=5s  ("reminder" events for tasks due within the hour)
+//             go run . -project-quota=1                   (one worker per project; watch "parked" on GET /api/projects)
+//             go run . -trash-retention=2m -purge-every=10s   (DELETEd tasks sit in GET /api/trash for 2 minutes)
+//             curl -H 'X-API-Key: alice-key' "http://localhost:8080/api/tasks/<id>/history?at=2026-01-02T15:04:05Z"
+//             (who changed what, and the task as it was at that moment; omit ?at= for the entries)
+// Every /api call needs credentials, e.g. -H 'X-API-Key: alice-key'
+// (demo keys: alice-key, bob-key, admin-key) or a bearer token from
+// POST /api/tokens; SSE and WebSocket clients can pass ?access_token=.
 // Terminal 2: .\test.ps1
+// Terminal 3: curl -N -H 'X-API-Key: alice-key' "http://localhost:8080/api/tasks/events?status=completed"   (live SSE)
+//             curl -X POST -H 'X-API-Key: alice-key' -H 'If-Match: "1"' http://localhost:8080/api/tasks/<id>/cancel
+//             (412 once a worker has moved the task on; GET it for the current ETag)
+//             curl -H 'X-API-Key: alice-key' http://localhost:8080/api/tasks/<id>/graph
+//             (POST a task with "dependsOn": ["<id>"]; it waits, and is cancelled if <id> fails)
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"flag"
+	"sync"
+	"time"
+)
+
+// ─── PRIORITY QUEUE + DISPATCHER ───
+//
+// Producers push into a heap; one dispatcher goroutine pops the most
+// urgent task and hands it to the workers over the unbuffered jobs
+// channel. Higher Priority runs first, ties are FIFO.
+//
+// Aging: a waiting task gains one priority level per -aging interval, so
+// a steady stream of high-priority work can't starve low-priority tasks
+// forever. Since every waiting task ages at the same rate, the ordering
+// key priority − enqueuedAt/interval never changes while a task waits,
+// and the heap stays valid without re-sorting.
+
+var agingInterval = flag.Duration("aging", 10*time.Second, "a waiting task gains one priority level per interval (0 = off)")
+
+type pqItem struct {
+	task Task
+	key  float64 // higher runs first
+	seq  uint64  // FIFO tie-break
+}
+
+type pqHeap []pqItem
+
+func (h pqHeap) Len() int { return len(h) }
+func (h pqHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key > h[j].key
+	}
+	return h[i].seq < h[j].seq
+}
+func (h pqHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *pqHeap) Push(x any)   { *h = append(*h, x.(pqItem)) }
+func (h *pqHeap) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}
+
+type taskQueue struct {
+	mu       sync.Mutex
+	items    pqHeap
+	capacity int
+	seq      uint64
+	epoch    time.Time
+	closed   bool
+	pushed   chan struct{} // signalled on every push
+	space    chan struct{} // signalled on every pop
+}
+
+var queue *taskQueue
+
+func newTaskQueue(capacity int) *taskQueue {
+	return &taskQueue{
+		capacity: capacity,
+		epoch:    time.Now(),
+		pushed:   make(chan struct{}, 1),
+		space:    make(chan struct{}, 1),
+	}
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (q *taskQueue) key(t Task) float64 {
+	k := float64(t.Priority)
+	if *agingInterval > 0 {
+		k -= float64(time.Since(q.epoch)) / float64(*agingInterval)
+	}
+	return k
+}
+
+// push adds t; with force it ignores capacity (retries, recovery).
+func (q *taskQueue) push(t Task, force bool) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || (!force && len(q.items) >= q.capacity) {
+		return false
+	}
+	q.seq++
+	heap.Push(&q.items, pqItem{task: t, key: q.key(t), seq: q.seq})
+	notify(q.pushed)
+	return true
+}
+
+// TryPush admits t only if there is room.
+func (q *taskQueue) TryPush(t Task) bool { return q.push(t, false) }
+
+// Push always admits t unless the queue is closed.
+func (q *taskQueue) Push(t Task) bool { return q.push(t, true) }
+
+// PushWait waits for room, giving up when ctx ends or the queue closes.
+func (q *taskQueue) PushWait(ctx context.Context, t Task) bool {
+	for {
+		if q.TryPush(t) {
+			return true
+		}
+		if q.isClosed() {
+			return false
+		}
+		select {
+		case <-q.space:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (q *taskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+func (q *taskQueue) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// Close stops new pushes; the dispatcher drains what is left.
+func (q *taskQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	notify(q.pushed)
+}
+
+// pop removes the best item; done is true once closed and empty.
+func (q *taskQueue) pop() (it pqItem, ok, done bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return it, false, q.closed
+	}
+	it = heap.Pop(&q.items).(pqItem)
+	notify(q.space)
+	return it, true, false
+}
+
+// putBack returns a popped item with its original key and sequence.
+func (q *taskQueue) putBack(it pqItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	heap.Push(&q.items, it)
+}
+
+// dispatch feeds out until the queue is closed and drained, then closes
+// out so the workers' range loops end. While it waits for a free worker,
+// a newly pushed task can preempt the one it holds.
+func (q *taskQueue) dispatch(out chan<- Task) {
+	defer close(out)
+	for {
+		it, ok, done := q.pop()
+		if done {
+			return
+		}
+		if !ok {
+			<-q.pushed
+			continue
+		}
+
+		select {
+		case out <- it.task:
+		case <-q.pushed:
+			// something new arrived — re-evaluate who goes first
+			q.putBack(it)
+		}
+	}
+}
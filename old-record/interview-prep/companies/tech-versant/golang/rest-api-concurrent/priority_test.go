@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func withAging(t *testing.T, d time.Duration) {
+	old := *agingInterval
+	*agingInterval = d
+	t.Cleanup(func() { *agingInterval = old })
+}
+
+// drain closes q and collects what dispatch hands to the workers.
+func drain(q *taskQueue) []Task {
+	q.Close()
+	out := make(chan Task)
+	go q.dispatch(out)
+	var got []Task
+	for t := range out {
+		got = append(got, t)
+	}
+	return got
+}
+
+func TestQueueOrderUnderConcurrentProducers(t *testing.T) {
+	withAging(t, 0)
+	const producers, perProducer = 8, 200
+	q := newTaskQueue(producers * perProducer)
+
+	var wg sync.WaitGroup
+	for p := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perProducer {
+				task := Task{ID: fmt.Sprintf("%d-%04d", p, i), Priority: (p + i) % 3}
+				if !q.TryPush(task) {
+					t.Errorf("push %s refused", task.ID)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	got := drain(q)
+	if len(got) != producers*perProducer {
+		t.Fatalf("dispatched %d tasks; want %d", len(got), producers*perProducer)
+	}
+	last := map[[2]int]int{} // (priority, producer) → last index seen
+	for i, task := range got {
+		if i > 0 && task.Priority > got[i-1].Priority {
+			t.Fatalf("task %s (priority %d) came after %s (priority %d)", task.ID, task.Priority, got[i-1].ID, got[i-1].Priority)
+		}
+		var p, n int
+		fmt.Sscanf(task.ID, "%d-%d", &p, &n)
+		k := [2]int{task.Priority, p}
+		if prev, ok := last[k]; ok && n < prev {
+			t.Fatalf("producer %d: task %d came after task %d at the same priority", p, n, prev)
+		}
+		last[k] = n
+	}
+}
+
+func TestQueueFIFOWithinPriority(t *testing.T) {
+	withAging(t, 0)
+	q := newTaskQueue(10)
+	for _, task := range []Task{{ID: "a", Priority: 1}, {ID: "b", Priority: 5}, {ID: "c", Priority: 1}, {ID: "d", Priority: 5}, {ID: "e"}} {
+		q.TryPush(task)
+	}
+	var order string
+	for _, task := range drain(q) {
+		order += task.ID
+	}
+	if order != "bdace" {
+		t.Fatalf("dispatch order %q; want bdace", order)
+	}
+}
+
+func TestQueueAgingPromotesStarvedTasks(t *testing.T) {
+	withAging(t, time.Hour)
+	q := newTaskQueue(10)
+	q.TryPush(Task{ID: "old", Priority: 0})
+
+	// three intervals pass: "old" now ranks like a priority-3 task
+	q.epoch = q.epoch.Add(-3 * time.Hour)
+	q.TryPush(Task{ID: "p2", Priority: 2})
+	q.TryPush(Task{ID: "p3", Priority: 3})
+	q.TryPush(Task{ID: "p4", Priority: 4})
+
+	var order string
+	for _, task := range drain(q) {
+		order += task.ID + " "
+	}
+	if order != "p4 old p3 p2 " {
+		t.Fatalf("dispatch order %q; want p4 old p3 p2 (old waited 3 intervals and outranks p2, ties with p3 and was first)", order)
+	}
+}
+
+func TestQueueCapacity(t *testing.T) {
+	q := newTaskQueue(1)
+	if !q.TryPush(Task{ID: "a"}) || q.TryPush(Task{ID: "b"}) {
+		t.Fatal("TryPush should admit one task into a queue of capacity 1")
+	}
+	if !q.Push(Task{ID: "c"}) || q.Len() != 2 {
+		t.Fatal("Push should ignore capacity")
+	}
+	q.Close()
+	if q.Push(Task{ID: "d"}) {
+		t.Fatal("Push after Close should be refused")
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"taskkit/ids"
+	"taskkit/storage"
+	"taskkit/validate"
+)
+
+// ─── PROJECTS ───
+//
+// A project is a namespace for tasks. Every task-scoped route exists twice:
+//
+//	/api/tasks/...                   the default project (projectId "")
+//	/api/projects/{pid}/tasks/...    project pid
+//
+// and the same for dead letters, schedules and the WebSocket API. inProject puts the project
+// in the request context and canAccess compares it with the task's, so a
+// task, its events, its dead letter and its schedule are only reachable
+// under their own project; an ID from another project is a 404 like any
+// unknown ID. Each project is its own ID space: the store keys tasks by
+// taskKey(project, id), and lookups go through the request's project, so
+// a task is never found by its ID alone.
+//
+// A project's tasks occupy at most its quota of the workers (-project-quota
+// unless the project sets one); tasks outside any project share the same
+// -project-quota as one more tenant. The overflow is parked like a job
+// type at its limit, so a flood from one tenant, the default project
+// included, cannot take every worker.
+//
+// Archiving cancels the project's open tasks and disables its schedules;
+// the project stays readable but refuses writes (409). Deleting does the
+// same, then removes the tasks, the schedules and the project.
+
+var projectsPath = flag.String("projects", "", "file to persist projects in (default: <data>.projects with the json/log store)")
+var projectQuota = flag.Int("project-quota", 2, "how many workers one project's tasks may occupy at once")
+
+// taskKey is the store key of task id in project pid. The default
+// project's keys are the bare IDs, so stores written before projects
+// existed load unchanged.
+func taskKey(pid, id string) string {
+	if pid == "" {
+		return id
+	}
+	return pid + "/" + id
+}
+
+// key is t's store key; see taskKey.
+func (t Task) key() string { return taskKey(t.ProjectID, t.ID) }
+
+type Project struct {
+	ID         string     `json:"id" validate:"readonly"`
+	Name       string     `json:"name" validate:"required,max=100"`
+	Quota      int        `json:"quota" validate:"min=0,max=100"` // workers it may occupy; 0 = -project-quota
+	OwnerID    string     `json:"ownerId" validate:"readonly"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty" validate:"readonly"`
+	CreatedAt  time.Time  `json:"createdAt" validate:"readonly"`
+}
+
+// ProjectStore keeps projects in memory and, when path is set, mirrors
+// them to a JSON snapshot after every change, like ScheduleStore.
+type ProjectStore struct {
+	mu    sync.RWMutex
+	items map[string]Project
+	path  string
+}
+
+var projects *ProjectStore
+
+func OpenProjectStore(path string) (*ProjectStore, error) {
+	s := &ProjectStore{items: make(map[string]Project), path: path}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	var list []Project
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	for _, p := range list {
+		s.items[p.ID] = p
+	}
+	return s, nil
+}
+
+func (s *ProjectStore) GetAll() []Project {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Project, 0, len(s.items))
+	for _, p := range s.items {
+		list = append(list, p)
+	}
+	slices.SortFunc(list, func(a, b Project) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return list
+}
+
+func (s *ProjectStore) Get(id string) (Project, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.items[id]
+	return p, ok
+}
+
+func (s *ProjectStore) Set(p Project) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[p.ID] = p
+	return s.flush()
+}
+
+func (s *ProjectStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.items, id)
+	return s.flush()
+}
+
+// flush must be called with mu held.
+func (s *ProjectStore) flush() error {
+	if s.path == "" {
+		return nil
+	}
+	list := make([]Project, 0, len(s.items))
+	for _, p := range s.items {
+		list = append(list, p)
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding projects: %w", err)
+	}
+	return storage.WriteFileAtomic(s.path, data)
+}
+
+// ─── SCOPE ───
+
+// projectFrom returns the project the request is scoped to; "" is the
+// default project.
+func projectFrom(ctx context.Context) string {
+	pid, _ := ctx.Value(projectKey).(string)
+	return pid
+}
+
+// inProject scopes a route to the {pid} in its pattern; routes without
+// one stay in the default project. Projects the caller can't see answer
+// 404, writes to an archived one 409.
+func inProject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pid := r.PathValue("pid")
+		if pid == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p, ok := getVisibleProject(r.Context(), pid)
+		if !ok {
+			http.Error(w, "project not found", http.StatusNotFound)
+			return
+		}
+		if p.ArchivedAt != nil && r.Method != http.MethodGet {
+			http.Error(w, "project is archived", http.StatusConflict)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), projectKey, pid)))
+	})
+}
+
+// getVisibleProject hides other users' projects; admins see them all.
+func getVisibleProject(ctx context.Context, id string) (Project, bool) {
+	p, ok := projects.Get(id)
+	u, _ := UserFrom(ctx)
+	if !ok || u.Role != RoleAdmin && p.OwnerID != u.ID {
+		return Project{}, false
+	}
+	return p, true
+}
+
+// ─── WORKER QUOTAS ───
+
+var quotas = struct {
+	mu sync.Mutex
+	m  map[string]*slots
+}{m: make(map[string]*slots)}
+
+// projectSlots returns the worker quota of project pid, created on first
+// use. Entries outlive deleted projects: a worker may still hold a slot.
+// The default project ("") has no record, so it gets -project-quota like
+// any project that does not set its own.
+func projectSlots(pid string) *slots {
+	quotas.mu.Lock()
+	defer quotas.mu.Unlock()
+	s, ok := quotas.m[pid]
+	if !ok {
+		limit := *projectQuota
+		if p, ok := projects.Get(pid); ok && p.Quota > 0 {
+			limit = p.Quota
+		}
+		s = &slots{limit: limit}
+		quotas.m[pid] = s
+	}
+	return s
+}
+
+// ─── CASCADE ───
+
+// closeProject cancels every open task of pid and disables its
+// schedules, then returns the project's tasks.
+func closeProject(ctx context.Context, pid string) []Task {
+	var tasks []Task
+	for _, t := range store.GetAll() {
+		if t.ProjectID != pid {
+			continue
+		}
+		tasks = append(tasks, t)
+		if !t.open() {
+			continue
+		}
+		// a dependency cancelled first may already have cancelled t
+		if _, err := cancelByID(ctx, t.key(), nil); err != nil && !errors.Is(err, ErrInvalidTransition) {
+			taskLog(t).Error("closing project: cancelling task", "project_id", pid, "err", err)
+		}
+	}
+	for _, sc := range schedules.GetAll() {
+		if sc.Task.ProjectID != pid || !sc.Enabled {
+			continue
+		}
+		sc.Enabled = false // the scheduler ignores heap entries of disabled schedules
+		if err := schedules.Set(sc); err != nil {
+			slog.Error("closing project: disabling schedule", "project_id", pid, "schedule_id", sc.ID, "err", err)
+		}
+	}
+	return tasks
+}
+
+// ─── HANDLERS ───
+
+// projectView is a Project plus its live worker usage.
+type projectView struct {
+	Project
+	Limit  int `json:"limit"` // effective quota
+	Active int `json:"active"`
+	Parked int `json:"parked"`
+}
+
+func viewProject(p Project) projectView {
+	v := projectView{Project: p}
+	v.Limit, v.Active, v.Parked = projectSlots(p.ID).stats()
+	return v
+}
+
+func writeProject(w http.ResponseWriter, status int, p Project) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(viewProject(p))
+}
+
+func getProjects(w http.ResponseWriter, r *http.Request) {
+	visible := []projectView{}
+	for _, p := range projects.GetAll() {
+		if _, ok := getVisibleProject(r.Context(), p.ID); ok {
+			visible = append(visible, viewProject(p))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
+}
+
+func getProject(w http.ResponseWriter, r *http.Request) {
+	p, ok := getVisibleProject(r.Context(), r.PathValue("pid"))
+	if !ok {
+		http.Error(w, "project not found", http.StatusNotFound)
+		return
+	}
+	writeProject(w, http.StatusOK, p)
+}
+
+func createProject(w http.ResponseWriter, r *http.Request) {
+	var p Project
+	err := validate.WithRules(validate.DecodeJSON(w, r, &p), func() error { return validate.Struct(&p, true).Err() })
+	if err != nil {
+		validate.WriteDecodeError(w, err)
+		return
+	}
+	p.ID = ids.New()
+	u, _ := UserFrom(r.Context())
+	p.OwnerID = u.ID
+	p.CreatedAt = time.Now()
+	if err := projects.Set(p); err != nil {
+		http.Error(w, "could not save project", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/api/projects/"+p.ID)
+	writeProject(w, http.StatusCreated, p)
+}
+
+// archiveProject is POST /api/projects/{pid}/archive.
+func archiveProject(w http.ResponseWriter, r *http.Request) {
+	p, ok := getVisibleProject(r.Context(), r.PathValue("pid"))
+	if !ok {
+		http.Error(w, "project not found", http.StatusNotFound)
+		return
+	}
+	if p.ArchivedAt != nil {
+		http.Error(w, "project already archived", http.StatusConflict)
+		return
+	}
+	now := time.Now()
+	p.ArchivedAt = &now
+	if err := projects.Set(p); err != nil { // first, so inProject refuses new tasks
+		http.Error(w, "could not save project", http.StatusInternalServerError)
+		return
+	}
+	tasks := closeProject(r.Context(), p.ID)
+	logFrom(r.Context()).Info("project archived", "project_id", p.ID, "tasks", len(tasks))
+	writeProject(w, http.StatusOK, p)
+}
+
+// deleteProject is DELETE /api/projects/{pid}: the project, its tasks and
+// its schedules are gone for good.
+func deleteProject(w http.ResponseWriter, r *http.Request) {
+	p, ok := getVisibleProject(r.Context(), r.PathValue("pid"))
+	if !ok {
+		http.Error(w, "project not found", http.StatusNotFound)
+		return
+	}
+	if p.ArchivedAt == nil {
+		now := time.Now()
+		p.ArchivedAt = &now
+		if err := projects.Set(p); err != nil {
+			http.Error(w, "could not save project", http.StatusInternalServerError)
+			return
+		}
+	}
+	tasks := closeProject(r.Context(), p.ID)
+	repo := withActor(store, actorFrom(r.Context()))
+	for _, t := range tasks {
+		if err := repo.Delete(t.key()); err != nil && !errors.Is(err, ErrNotFound) {
+			http.Error(w, "could not delete task "+t.ID, http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, sc := range schedules.GetAll() {
+		if sc.Task.ProjectID == p.ID {
+			if err := schedules.Delete(sc.ID); err != nil && !errors.Is(err, ErrNotFound) {
+				http.Error(w, "could not delete schedule "+sc.ID, http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	if err := projects.Delete(p.ID); err != nil && !errors.Is(err, ErrNotFound) {
+		http.Error(w, "could not delete project", http.StatusInternalServerError)
+		return
+	}
+	logFrom(r.Context()).Info("project deleted", "project_id", p.ID, "tasks", len(tasks))
+	w.WriteHeader(http.StatusNoContent)
+}
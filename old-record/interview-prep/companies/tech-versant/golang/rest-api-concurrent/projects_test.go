@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Each project is its own ID space: a task of project A is a 404 under
+// project B and in the default project, for every route that takes an ID.
+
+type server struct {
+	t       *testing.T
+	handler http.Handler
+}
+
+// newServer wires the globals the handlers use, like main does, without
+// workers: created tasks stay queued. They are put back when t ends.
+func newServer(t *testing.T) *server {
+	t.Helper()
+	oldUsers, oldSignKey := users, signKey
+	oldHistory, oldSchedules, oldProjects := history, schedules, projects
+	oldBroker, oldStore, oldScheduler, oldQueue := broker, store, scheduler, queue
+	oldQuotas, oldInFlight := quotas.m, inFlight.n
+	t.Cleanup(func() {
+		// WebSocket handlers unsubscribe as their connections close,
+		// which the tests' own cleanups (run first) have done
+		for deadline := time.Now().Add(5 * time.Second); broker.subscribers() > 0 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		queue.Close()
+		history.Close()
+		users, signKey = oldUsers, oldSignKey
+		history, schedules, projects = oldHistory, oldSchedules, oldProjects
+		broker, store, scheduler, queue = oldBroker, oldStore, oldScheduler, oldQueue
+		quotas.m, inFlight.n = oldQuotas, oldInFlight
+	})
+	quotas.m, inFlight.n = make(map[string]*slots), make(map[string]int)
+
+	if err := setupAuth("", "projects-test"); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if history, err = OpenHistory(""); err != nil {
+		t.Fatal(err)
+	}
+	if schedules, err = OpenScheduleStore(""); err != nil {
+		t.Fatal(err)
+	}
+	if projects, err = OpenProjectStore(""); err != nil {
+		t.Fatal(err)
+	}
+	broker = NewBroker(10)
+	store = auditRepo{TaskRepository: publishingRepo{TaskRepository: NewTaskStore(), broker: broker}, history: history, actor: Actor{Source: SourceSystem}}
+	scheduler = NewScheduler(realClock{}, store, schedules, func(Task) bool { return true })
+	queue = newTaskQueue(100)
+
+	mux := http.NewServeMux()
+	routes(mux)
+	return &server{t, chain(mux, requestID, rateLimit(nil, mux), authenticate)}
+}
+
+// do sends body (nil = none) as alice and decodes the answer into out.
+func (s *server) do(method, path string, body, out any) int {
+	s.t.Helper()
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("X-API-Key", "alice-key")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("%s %s: decoding %q: %v", method, path, rec.Body, err)
+		}
+	}
+	return rec.Code
+}
+
+func (s *server) project(name string) string {
+	s.t.Helper()
+	var p Project
+	if code := s.do("POST", "/api/projects", map[string]any{"name": name}, &p); code != http.StatusCreated {
+		s.t.Fatalf("creating project %s: %d", name, code)
+	}
+	return "/api/projects/" + p.ID
+}
+
+func TestProjectIsolation(t *testing.T) {
+	s := newServer(t)
+	a, b := s.project("a"), s.project("b")
+
+	var task Task
+	if code := s.do("POST", a+"/tasks", map[string]any{"title": "secret"}, &task); code != http.StatusCreated {
+		t.Fatalf("creating task in a: %d", code)
+	}
+	if code := s.do("GET", a+"/tasks/"+task.ID, nil, nil); code != http.StatusOK {
+		t.Fatalf("GET in its own project: %d", code)
+	}
+
+	for _, other := range []string{b, "/api"} {
+		for _, r := range []struct {
+			method, path string
+			body         any
+		}{
+			{"GET", "/tasks/" + task.ID, nil},
+			{"GET", "/tasks/" + task.ID + "/graph", nil},
+			{"GET", "/tasks/" + task.ID + "/history", nil},
+			{"POST", "/tasks/" + task.ID + "/cancel", nil},
+			{"PUT", "/tasks/" + task.ID + "/dependencies", map[string]any{"dependsOn": []string{}}},
+			{"DELETE", "/tasks/" + task.ID, nil},
+			{"POST", "/tasks/" + task.ID + "/restore", nil},
+			{"POST", "/dead-letters/" + task.ID + "/replay", nil},
+		} {
+			if code := s.do(r.method, other+r.path, r.body, nil); code != http.StatusNotFound {
+				t.Errorf("%s %s%s → %d; want 404", r.method, other, r.path, code)
+			}
+		}
+
+		var list []Task
+		s.do("GET", other+"/tasks", nil, &list)
+		if len(list) != 0 {
+			t.Errorf("GET %s/tasks listed %v", other, list)
+		}
+		if code := s.do("POST", other+"/tasks", map[string]any{"title": "x", "dependsOn": []string{task.ID}}, nil); code != http.StatusBadRequest {
+			t.Errorf("depending on a task of another project under %s → %d; want 400", other, code)
+		}
+	}
+
+	// none of that touched it
+	var got Task
+	s.do("GET", a+"/tasks/"+task.ID, nil, &got)
+	if got.Status != StatusPending || got.trashed() || got.Version != task.Version {
+		t.Fatalf("after the calls from other projects: %+v; want it untouched", got)
+	}
+}
+
+func TestProjectsHaveSeparateIDSpaces(t *testing.T) {
+	s := newServer(t)
+	a, b := s.project("a"), s.project("b")
+	pa, pb := a[len("/api/projects/"):], b[len("/api/projects/"):]
+
+	// IDs are generated, so only a store write can make two projects
+	// share one
+	for _, task := range []Task{
+		{ID: "same", Title: "in a", Status: StatusPending, OwnerID: "alice", ProjectID: pa},
+		{ID: "same", Title: "in b", Status: StatusPending, OwnerID: "alice", ProjectID: pb},
+		{ID: "same", Title: "in default", Status: StatusPending, OwnerID: "alice"},
+	} {
+		store.Set(task)
+	}
+
+	for prefix, want := range map[string]string{a: "in a", b: "in b", "/api": "in default"} {
+		var got Task
+		if code := s.do("GET", prefix+"/tasks/same", nil, &got); code != http.StatusOK || got.Title != want {
+			t.Fatalf("GET %s/tasks/same → %d %q; want %q", prefix, code, got.Title, want)
+		}
+	}
+
+	if code := s.do("POST", a+"/tasks/same/cancel", nil, nil); code != http.StatusOK {
+		t.Fatalf("cancel in a: %d", code)
+	}
+	if code := s.do("DELETE", b+"/tasks/same", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("delete in b: %d", code)
+	}
+	var inA, inDefault Task
+	s.do("GET", a+"/tasks/same", nil, &inA)
+	s.do("GET", "/api/tasks/same", nil, &inDefault)
+	if inA.Status != StatusCancelled || inDefault.Status != StatusPending || inDefault.trashed() {
+		t.Fatalf("a: %s, default: %s trashed=%v; want only a's copy cancelled and only b's trashed", inA.Status, inDefault.Status, inDefault.trashed())
+	}
+
+	// each copy keeps its own history
+	var hist []HistoryEntry
+	s.do("GET", a+"/tasks/same/history", nil, &hist)
+	if len(hist) != 2 || hist[1].ProjectID != pa {
+		t.Fatalf("history in a: %+v; want created and cancelled, both in a", hist)
+	}
+}
+
+func TestRepositoryKeysByProject(t *testing.T) {
+	for _, kind := range []string{"memory", "json", "log"} {
+		t.Run(kind, func(t *testing.T) { testRepositoryKeysByProject(t, kind) })
+	}
+}
+
+func testRepositoryKeysByProject(t *testing.T, kind string) {
+	path := filepath.Join(t.TempDir(), "tasks.data")
+	repo, err := openRepository(kind, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	repo.Set(Task{ID: "x", Title: "default"})
+	repo.Set(Task{ID: "x", Title: "p", ProjectID: "p", Tags: []string{"t"}})
+
+	if got, _ := repo.Get(taskKey("p", "x")); got.Title != "p" || got.Version != 1 {
+		t.Fatalf("Get(p/x) = %+v; want p's task at version 1", got)
+	}
+	if _, err := repo.CompareAndSwap(Task{ID: "x", Title: "p2", ProjectID: "p"}, 1); err != nil {
+		t.Fatalf("CAS in p: %v", err)
+	}
+	if got, _ := repo.Get("x"); got.Title != "default" || got.Version != 1 {
+		t.Fatalf("Get(x) = %+v; want the default project's task untouched", got)
+	}
+	if err := repo.Delete(taskKey("p", "x")); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.ByTag("t")) != 0 {
+		t.Fatal("ByTag still finds the deleted task")
+	}
+	if kind == "memory" {
+		return
+	}
+	repo.Close()
+	reopened, err := openRepository(kind, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	all := reopened.GetAll()
+	if len(all) != 1 || all[0].Title != "default" {
+		t.Fatalf("after reopen GetAll = %+v; want only the default project's task", all)
+	}
+}
+
+// A dependency ID is resolved in the dependent's project.
+func TestDependenciesStayInProject(t *testing.T) {
+	repo := NewTaskStore()
+	repo.Set(Task{ID: "dep", Status: StatusCompleted})
+	repo.Set(Task{ID: "dep", Status: StatusProcessing, ProjectID: "p"})
+
+	if waiting, _ := waitState(repo, Task{ID: "t", DependsOn: []string{"dep"}, ProjectID: "p"}); !waiting {
+		t.Fatal("a task in p saw the default project's completed dep")
+	}
+	if waiting, _ := waitState(repo, Task{ID: "t", DependsOn: []string{"dep"}}); waiting {
+		t.Fatal("a task in the default project saw p's running dep")
+	}
+	if _, broken := waitState(repo, Task{ID: "t", DependsOn: []string{"dep"}, ProjectID: "q"}); broken == "" {
+		t.Fatal("a task in q found dep, which only exists in other projects")
+	}
+
+	repo.Set(Task{ID: "a", DependsOn: []string{"b"}, ProjectID: "p"})
+	if c := findCycle(repo, "q", "b", []string{"a"}); c != nil {
+		t.Fatalf("findCycle followed p's edges from q: %v", c)
+	}
+	if c := findCycle(repo, "p", "b", []string{"a"}); !slices.Equal(c, []string{"b", "a", "b"}) {
+		t.Fatalf("findCycle in p = %v; want b → a → b", c)
+	}
+}
+
+// Tasks outside any project are a tenant like any other: they cannot
+// take more than -project-quota workers either.
+func TestDefaultProjectHasQuota(t *testing.T) {
+	newServer(t)
+	s := projectSlots("")
+	for i := range *projectQuota {
+		if !s.acquire(Task{ID: string(rune('a' + i))}) {
+			t.Fatalf("task %d of the default project parked below the quota of %d", i, *projectQuota)
+		}
+	}
+	if s.acquire(Task{ID: "over"}) {
+		t.Fatalf("the default project took more than %d workers", *projectQuota)
+	}
+}
+
+func (b *Broker) subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ─── LIST QUERY (filter, sort, keyset pagination) ───
+//
+// GET /api/tasks?done=&status=&tag=&overdue=&q=&sort=&limit=&next=
+//
+// Pagination is keyset-based: the "next" token encodes the sort key and
+// ID of the last task on the page, and the following page starts strictly
+// after that key. Unlike offsets, this never skips or repeats a task when
+// other tasks are created, deleted or change status between requests.
+
+const maxPageSize = 100
+
+type taskQuery struct {
+	done    *bool
+	status  string
+	tag     string
+	overdue *bool
+	now     time.Time // what overdue is judged against
+	q       string
+	sort    string // "createdAt" | "-createdAt" | "title" | "-title"
+	limit   int    // 0 = return everything
+	after   *cursor
+}
+
+// cursor is both the sort key of a task and the decoded "next" token.
+type cursor struct {
+	Sort    string `json:"s"`
+	Title   string `json:"t,omitempty"`
+	Created int64  `json:"c,omitempty"`
+	ID      string `json:"id"`
+}
+
+var validStatuses = map[string]bool{
+	StatusPending: true, StatusProcessing: true, StatusCompleted: true,
+	StatusCancelled: true, StatusTimedOut: true, StatusFailed: true,
+}
+
+func parseTaskQuery(v url.Values) (taskQuery, error) {
+	q := taskQuery{
+		status: v.Get("status"),
+		tag:    strings.ToLower(strings.TrimSpace(v.Get("tag"))),
+		now:    time.Now(),
+		q:      strings.ToLower(v.Get("q")),
+		sort:   v.Get("sort"),
+	}
+
+	if s := v.Get("done"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, errors.New("done must be true or false")
+		}
+		q.done = &b
+	}
+	if q.status != "" && !validStatuses[q.status] {
+		return q, errors.New("status must be pending, processing, completed, cancelled, timed_out or failed")
+	}
+
+	if s := v.Get("overdue"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, errors.New("overdue must be true or false")
+		}
+		q.overdue = &b
+	}
+
+	switch q.sort {
+	case "":
+		q.sort = "createdAt"
+	case "createdAt", "-createdAt", "title", "-title":
+	default:
+		return q, errors.New("sort must be title, -title, createdAt or -createdAt")
+	}
+
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			return q, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageSize))
+		}
+		q.limit = n
+	}
+
+	if s := v.Get("next"); s != "" {
+		c, err := decodeCursor(s)
+		if err != nil || c.Sort != q.sort {
+			return q, errors.New("invalid next token")
+		}
+		q.after = &c
+	}
+	return q, nil
+}
+
+func (q taskQuery) match(t Task) bool {
+	if q.done != nil && t.Done != *q.done {
+		return false
+	}
+	if q.status != "" && t.Status != q.status {
+		return false
+	}
+	if q.tag != "" && !slices.Contains(t.Tags, q.tag) {
+		return false
+	}
+	if q.overdue != nil && t.overdue(q.now) != *q.overdue {
+		return false
+	}
+	if q.q != "" && !strings.Contains(strings.ToLower(t.Title), q.q) {
+		return false
+	}
+	return true
+}
+
+// candidates is what apply should filter: the tag index narrows it down
+// when the query names a tag.
+func (q taskQuery) candidates(repo TaskRepository) []Task {
+	if q.tag != "" {
+		return repo.ByTag(q.tag)
+	}
+	return repo.GetAll()
+}
+
+// apply filters and sorts tasks and cuts out one page. next is empty on
+// the last page.
+func (q taskQuery) apply(tasks []Task) (page []Task, next string) {
+	page = make([]Task, 0, len(tasks))
+	for _, t := range tasks {
+		if !q.match(t) {
+			continue
+		}
+		if q.after != nil && compareKeys(keyOf(t, q.sort), *q.after) <= 0 {
+			continue
+		}
+		page = append(page, t)
+	}
+
+	slices.SortFunc(page, func(a, b Task) int {
+		return compareKeys(keyOf(a, q.sort), keyOf(b, q.sort))
+	})
+
+	if q.limit == 0 || len(page) <= q.limit {
+		return page, ""
+	}
+	page = page[:q.limit]
+	return page, encodeCursor(keyOf(page[len(page)-1], q.sort))
+}
+
+func keyOf(t Task, sort string) cursor {
+	c := cursor{Sort: sort, ID: t.ID}
+	if strings.TrimPrefix(sort, "-") == "title" {
+		c.Title = t.Title
+	} else {
+		c.Created = t.CreatedAt.UnixNano()
+	}
+	return c
+}
+
+// compareKeys orders by the sort field, then by ID so ties are stable.
+func compareKeys(a, b cursor) int {
+	var c int
+	if strings.TrimPrefix(a.Sort, "-") == "title" {
+		c = strings.Compare(a.Title, b.Title)
+	} else {
+		c = cmp.Compare(a.Created, b.Created)
+	}
+	if c == 0 {
+		c = strings.Compare(a.ID, b.ID)
+	}
+	if strings.HasPrefix(a.Sort, "-") {
+		c = -c
+	}
+	return c
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+// nextLink builds the URL of the following page, keeping the caller's
+// filters.
+func nextLink(u *url.URL, next string) string {
+	v := u.Query()
+	v.Set("next", next)
+	return u.Path + "?" + v.Encode()
+}
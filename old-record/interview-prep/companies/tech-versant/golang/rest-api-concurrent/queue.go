@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// ─── ADMISSION CONTROL ───
+//
+// createTask never blocks on the queue. If it holds -queue-depth tasks the
+// task either spills to an on-disk overflow queue (-spill) or is rejected
+// with 429 + Retry-After so the client backs off.
+
+var errQueueFull = errors.New("job queue is full")
+
+// retryAfter is a rough hint: one simulated job takes ~2s.
+const retryAfter = "2"
+
+var spill *spillQueue // nil when -spill is not set
+
+// enqueue hands t to the workers without blocking. Once anything has
+// spilled, new tasks spill too so FIFO order is kept.
+func enqueue(t Task) error {
+	if spill == nil {
+		if !queue.TryPush(t) {
+			return errQueueFull
+		}
+		inFlight.add(t.key())
+		return nil
+	}
+
+	if spill.Len() == 0 && queue.TryPush(t) {
+		inFlight.add(t.key())
+		return nil
+	}
+	if err := spill.Push(t); err != nil {
+		return err
+	}
+	inFlight.add(t.key())
+	return nil
+}
+
+// inFlightTasks counts, per task key, the copies handed to the queue or
+// the spill that no worker has taken yet, parked ones included.
+// restoreTask checks it so a task trashed while queued is not queued
+// twice.
+type inFlightTasks struct {
+	mu sync.Mutex
+	n  map[string]int
+}
+
+var inFlight = inFlightTasks{n: make(map[string]int)}
+
+func (f *inFlightTasks) add(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n[key]++
+}
+
+// taken is called when a worker takes a copy of the task, whether it
+// runs or drops it.
+func (f *inFlightTasks) taken(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.n[key]--; f.n[key] <= 0 {
+		delete(f.n, key)
+	}
+}
+
+func (f *inFlightTasks) has(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.n[key] > 0
+}
+
+// feedFromSpill moves spilled tasks into the queue as room frees up.
+// Stops when ctx is cancelled; tasks still on disk are pending in the
+// store and get re-queued on the next start.
+func feedFromSpill(ctx context.Context, q *spillQueue) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.ready:
+		}
+
+		for {
+			t, ok, err := q.Peek()
+			if err != nil {
+				slog.Error("reading spill queue", "err", err)
+			}
+			if !ok {
+				break
+			}
+			if !queue.PushWait(ctx, t) {
+				return
+			}
+			q.Pop()
+		}
+	}
+}
+
+// ─── SPILL-TO-DISK QUEUE ───
+//
+// A FIFO of JSON lines: Push appends at the tail, Pop advances a head
+// offset. When the queue empties the file is truncated to reclaim space.
+// It is truncated on open as well — after a restart recoverUnfinished
+// re-queues pending tasks from the store, which is the source of truth.
+
+type spillQueue struct {
+	mu         sync.Mutex
+	file       *os.File
+	head, tail int64
+	n          int
+	ready      chan struct{} // signalled on Push
+}
+
+func openSpillQueue(path string) (*spillQueue, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening spill queue: %w", err)
+	}
+	return &spillQueue{file: f, ready: make(chan struct{}, 1)}, nil
+}
+
+func (q *spillQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
+
+func (q *spillQueue) Push(t Task) error {
+	line, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("encoding spilled task: %w", err)
+	}
+	line = append(line, '\n')
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.file.WriteAt(line, q.tail); err != nil {
+		return fmt.Errorf("spilling task: %w", err)
+	}
+	q.tail += int64(len(line))
+	q.n++
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Peek returns the head task without removing it.
+func (q *spillQueue) Peek() (Task, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var t Task
+	if q.n == 0 {
+		return t, false, nil
+	}
+	line, err := q.readHead()
+	if err != nil {
+		return t, false, err
+	}
+	if err := json.Unmarshal(line, &t); err != nil {
+		return t, false, fmt.Errorf("decoding spilled task: %w", err)
+	}
+	return t, true, nil
+}
+
+// Pop drops the head task.
+func (q *spillQueue) Pop() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.n == 0 {
+		return nil
+	}
+	line, err := q.readHead()
+	if err != nil {
+		return err
+	}
+	q.head += int64(len(line))
+	q.n--
+	if q.n == 0 {
+		q.head, q.tail = 0, 0
+		return q.file.Truncate(0)
+	}
+	return nil
+}
+
+func (q *spillQueue) readHead() ([]byte, error) {
+	r := bufio.NewReader(io.NewSectionReader(q.file, q.head, q.tail-q.head))
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading spill queue: %w", err)
+	}
+	return line, nil
+}
+
+func (q *spillQueue) Close() error { return q.file.Close() }
+
+// ─── QUEUE STATS ───
+
+type queueStats struct {
+	Depth    int  `json:"depth"`
+	Capacity int  `json:"capacity"`
+	Spilled  int  `json:"spilled"`
+	Spill    bool `json:"spillEnabled"`
+}
+
+func getQueue(w http.ResponseWriter, r *http.Request) {
+	s := queueStats{Depth: queue.Len(), Capacity: queue.capacity, Spill: spill != nil}
+	if spill != nil {
+		s.Spilled = spill.Len()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ─── RATE LIMITING (token bucket per client and route) ───
+//
+// Every client gets a bucket per limited route pattern plus one shared
+// bucket for all other routes. A bucket holds up to burst tokens and
+// refills at rate tokens per second; each request takes one token, or is
+// answered 429 when the bucket is empty.
+//
+// The limiter runs before authenticate, so requests with bad or missing
+// credentials are counted too: clients are keyed by user when their
+// credentials check out (an API key and the bearer tokens minted from it
+// share buckets), otherwise by remote IP, which bounds key and token
+// guessing.
+// X-Forwarded-For is deliberately ignored: without a trusted proxy in
+// front it is whatever the client says it is.
+
+var rateLimits = flag.String("rate-limits", "",
+	`per route "burst:rate/s" overrides, e.g. "POST /api/tasks=5:1,*=100:50" (* = every other route; "off" disables)`)
+
+type limitRule struct {
+	burst float64
+	rate  float64 // tokens per second
+}
+
+// defaultRateLimits is stricter on task creation: every accepted POST
+// costs storage and, in the worker pool, a queue slot.
+var defaultRateLimits = map[string]limitRule{
+	"*":                              {burst: 60, rate: 20},
+	"POST /api/tasks":                {burst: 10, rate: 2},
+	"POST /api/projects/{pid}/tasks": {burst: 10, rate: 2},
+}
+
+type bucketKey struct {
+	client string
+	route  string // pattern with its own rule, or "*"
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter is nil when -rate-limits=off.
+var limiter *rateLimiter
+
+type rateLimiter struct {
+	rules map[string]limitRule
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+}
+
+// newRateLimiter applies spec on top of the defaults. It returns nil
+// when spec is "off".
+func newRateLimiter(spec string) (*rateLimiter, error) {
+	if spec == "off" {
+		return nil, nil
+	}
+	l := &rateLimiter{
+		rules:   make(map[string]limitRule),
+		now:     time.Now,
+		buckets: make(map[bucketKey]*bucket),
+	}
+	for route, rule := range defaultRateLimits {
+		l.rules[route] = rule
+	}
+	if spec == "" {
+		return l, nil
+	}
+	for _, kv := range strings.Split(spec, ",") {
+		route, val, ok := strings.Cut(kv, "=")
+		b, r, ok2 := strings.Cut(val, ":")
+		burst, err1 := strconv.ParseFloat(b, 64)
+		rate, err2 := strconv.ParseFloat(r, 64)
+		if !ok || !ok2 || err1 != nil || err2 != nil || burst < 1 || rate <= 0 {
+			return nil, fmt.Errorf("bad -rate-limits entry %q", kv)
+		}
+		l.rules[strings.TrimSpace(route)] = limitRule{burst: burst, rate: rate}
+	}
+	return l, nil
+}
+
+// limitResult is what the X-RateLimit-* headers report.
+type limitResult struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration // until the bucket is full again
+	retryAfter time.Duration // until the next token, when refused
+}
+
+func (l *rateLimiter) allow(client, pattern string) limitResult {
+	route := pattern
+	rule, ok := l.rules[route]
+	if !ok {
+		route = "*"
+		rule = l.rules[route]
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := bucketKey{client, route}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rule.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(rule.burst, b.tokens+now.Sub(b.last).Seconds()*rule.rate)
+	b.last = now
+
+	res := limitResult{limit: int(rule.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.allowed = true
+	} else {
+		res.retryAfter = seconds((1 - b.tokens) / rule.rate)
+	}
+	res.remaining = int(b.tokens)
+	res.reset = seconds((rule.burst - b.tokens) / rule.rate)
+	return res
+}
+
+// allowCreate charges a task created over the WebSocket to the same
+// bucket as POST /api/tasks, so the socket is no way around the limit.
+func allowCreate(u User) limitResult {
+	if limiter == nil {
+		return limitResult{allowed: true}
+	}
+	return limiter.allow(userClient(u), "POST /api/tasks")
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// evictIdle drops buckets that have refilled completely. A full bucket
+// behaves exactly like a missing one, so this loses nothing and bounds
+// memory by the number of recently active clients.
+func (l *rateLimiter) evictIdle() int {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for key, b := range l.buckets {
+		rule, ok := l.rules[key.route]
+		if !ok || b.tokens+now.Sub(b.last).Seconds()*rule.rate >= rule.burst {
+			delete(l.buckets, key)
+			n++
+		}
+	}
+	return n
+}
+
+func (l *rateLimiter) evictLoop(ctx context.Context, every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			if n := l.evictIdle(); n > 0 {
+				slog.Debug("evicted idle rate-limit buckets", "count", n)
+			}
+		}
+	}
+}
+
+// clientKey identifies the caller for rate limiting. It runs ahead of
+// authenticate and checks the credentials itself.
+func clientKey(r *http.Request) string {
+	if u, err := credentials(r); err == nil {
+		return userClient(u)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func userClient(u User) string { return "user:" + u.ID }
+
+// rateLimit enforces l per client and per mux route pattern. It goes
+// before authenticate in the chain, so a 401 costs a token as well.
+func rateLimit(l *rateLimiter, mux *http.ServeMux) middleware {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, pattern := mux.Handler(r)
+			res := l.allow(clientKey(r), pattern)
+
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(res.limit))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(res.remaining))
+			h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(res.reset.Seconds()))))
+			if !res.allowed {
+				h.Set("Retry-After", strconv.Itoa(int(math.Ceil(res.retryAfter.Seconds()))))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
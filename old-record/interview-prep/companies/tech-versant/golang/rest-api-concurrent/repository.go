@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"taskkit/storage"
+)
+
+// ─── REPOSITORY INTERFACE ───
+//
+// Handlers and workers only talk to TaskRepository, so the storage backend
+// can be swapped with -store without touching them.
+//
+// Every backend owns Task.Version, CreatedAt and UpdatedAt: each write
+// stores the task as the previous version + 1, whatever the caller passed
+// in (see taskkit/storage, which holds the backends).
+//
+// Tasks are keyed by Task.key(), the ID qualified by the project, so each
+// project has its own ID space (see projects.go). Get and Delete take
+// that key.
+
+var (
+	ErrNotFound        = storage.ErrNotFound
+	ErrVersionConflict = storage.ErrVersionConflict
+)
+
+type TaskRepository interface {
+	GetAll() []Task
+	Get(key string) (Task, bool)
+	ByTag(tag string) []Task // served from a tag index, not a scan
+	Set(t Task) error        // unconditional: last write wins
+	// CompareAndSwap stores t only while its task is still at version
+	// (0 = must not exist yet) and returns what was stored, or
+	// ErrVersionConflict.
+	CompareAndSwap(t Task, version int64) (Task, error)
+	Delete(key string) error // ErrNotFound if key is unknown
+	Close() error
+}
+
+var (
+	storeKind = flag.String("store", "memory", "task storage backend: memory | json | log")
+	storePath = flag.String("data", "tasks.data", "file used by the json and log backends")
+)
+
+// openRepository builds the backend selected by -store.
+func openRepository(kind, path string) (TaskRepository, error) {
+	switch kind {
+	case "memory":
+		return NewTaskStore(), nil
+	case "json":
+		return storage.OpenJSONFile[Task](path)
+	case "log":
+		return storage.OpenLog[Task](path)
+	default:
+		return nil, fmt.Errorf("unknown store %q (want memory, json or log)", kind)
+	}
+}
+
+// NewTaskStore returns the in-memory backend.
+func NewTaskStore() *storage.Memory[Task] { return storage.NewMemory[Task]() }
+
+// Task implements storage.Record, which is all the backends need to key,
+// index and version it.
+
+func (t Task) StoreKey() string              { return t.key() }
+func (t Task) StoreTags() []string           { return t.Tags }
+func (t Task) StoreMeta() (int64, time.Time) { return t.Version, t.CreatedAt }
+func (t Task) WithMeta(version int64, created, updated time.Time) Task {
+	t.Version, t.CreatedAt, t.UpdatedAt = version, created, updated
+	return t
+}
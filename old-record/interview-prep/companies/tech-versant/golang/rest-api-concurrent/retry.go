@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"taskkit/etag"
+)
+
+// ─── RETRY POLICY ───
+//
+// A job error (other than cancel/timeout) is retried up to -max-attempts
+// times. Between attempts the task goes back to pending and is re-queued
+// after an exponential backoff with jitter; once attempts are exhausted
+// it lands in failed, which doubles as the dead-letter queue.
+
+var (
+	maxAttempts = flag.Int("max-attempts", 3, "attempts per task before it is dead-lettered")
+	retryBase   = flag.Duration("retry-base", 500*time.Millisecond, "backoff before the first retry")
+	retryMax    = flag.Duration("retry-max", 30*time.Second, "upper bound for a single backoff")
+)
+
+// backoff returns the wait before retry number attempt (1-based):
+// base·2^(attempt-1) capped at max, then "equal jitter" — a random point
+// in the upper half — so retries of many tasks don't line up.
+func backoff(attempt int) time.Duration {
+	d := *retryBase
+	for i := 1; i < attempt && d < *retryMax; i++ {
+		d *= 2
+	}
+	d = min(d, *retryMax)
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// handleJobError records err on the task and either schedules a retry or
+// dead-letters it. It returns the status the task moved to, or the error
+// saving it, in which case nothing was scheduled or dead-lettered.
+func handleJobError(ctx context.Context, store TaskRepository, t Task, err error) (string, error) {
+	recordErr := func(t *Task) { t.LastError = err.Error() }
+
+	if t.Attempts >= *maxAttempts {
+		if _, err := transition(store, t.key(), StatusFailed, recordErr); err != nil {
+			if errors.Is(err, ErrInvalidTransition) { // cancelled meanwhile
+				return StatusCancelled, nil
+			}
+			return "", err
+		}
+		taskLog(t).Warn("task dead-lettered", "attempts", t.Attempts, "err", err)
+		return StatusFailed, nil
+	}
+
+	next, err2 := transition(store, t.key(), StatusPending, recordErr)
+	if err2 != nil {
+		if errors.Is(err2, ErrInvalidTransition) { // cancelled meanwhile
+			return StatusCancelled, nil
+		}
+		return "", err2
+	}
+
+	delay := backoff(t.Attempts)
+	taskLog(t).Warn("attempt failed, retrying", "attempt", t.Attempts, "err", err, "backoff", delay.Round(time.Millisecond))
+	time.AfterFunc(delay, func() { requeue(ctx, next) })
+	return StatusPending, nil
+}
+
+// ─── DEAD LETTERS ───
+
+func getDeadLetters(w http.ResponseWriter, r *http.Request) {
+	q := taskQuery{status: StatusFailed, sort: "createdAt"}
+	page, _ := q.apply(visibleTasks(r.Context(), store.GetAll()))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// replayDeadLetter gives a failed task a fresh set of attempts. If-Match
+// is honoured (412).
+func replayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	key := taskKey(projectFrom(r.Context()), r.PathValue("id"))
+
+	transitionMu.Lock()
+	t, ok := store.Get(key)
+	if !ok || !canAccess(r.Context(), t) || t.trashed() {
+		transitionMu.Unlock()
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if t.Status != StatusFailed {
+		transitionMu.Unlock()
+		http.Error(w, "task is "+t.Status+", not failed", http.StatusConflict)
+		return
+	}
+	if !etag.IfMatch(r, t.Version) {
+		transitionMu.Unlock()
+		http.Error(w, "If-Match does not match the current ETag "+etag.Of(t.Version), http.StatusPreconditionFailed)
+		return
+	}
+	// deliberately outside the state machine: failed is terminal for workers
+	failed := t
+	t.Status = StatusPending
+	t.Attempts = 0
+	repo := withActor(store, actorFrom(r.Context()))
+	t, err := repo.CompareAndSwap(t, t.Version)
+	transitionMu.Unlock()
+	if errors.Is(err, ErrVersionConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not save task", http.StatusInternalServerError)
+		return
+	}
+
+	if !requeue(r.Context(), t) {
+		// undone, like submitTask does, so it stays a dead letter the
+		// client can replay again; a pending task nobody queued would
+		// only run after a restart
+		transitionMu.Lock()
+		_, err := repo.CompareAndSwap(failed, t.Version)
+		transitionMu.Unlock()
+		if err != nil {
+			taskLog(t).Error("replay: restoring dead letter", "err", err)
+		}
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "could not queue task", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("ETag", etag.Of(t.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(t)
+}
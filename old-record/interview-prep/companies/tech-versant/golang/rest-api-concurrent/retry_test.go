@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestReplayRollsBackWhenQueueRefuses(t *testing.T) {
+	s := newServer(t)
+	store.Set(Task{ID: "dead", Title: "x", Status: StatusFailed, Attempts: 3, OwnerID: "alice", LastError: "boom"})
+
+	queue.Close() // shutting down: requeue refuses
+	if code := s.do("POST", "/api/dead-letters/dead/replay", nil, nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("replay with the queue closed → %d; want 503", code)
+	}
+	got, _ := store.Get("dead")
+	if got.Status != StatusFailed || got.Attempts != 3 || inFlight.has("dead") {
+		t.Fatalf("after a refused replay: %s, %d attempts; want still failed with 3", got.Status, got.Attempts)
+	}
+
+	queue = newTaskQueue(10)
+	if code := s.do("POST", "/api/dead-letters/dead/replay", nil, nil); code != http.StatusAccepted {
+		t.Fatalf("replay again → %d; want 202", code)
+	}
+	if got, _ := store.Get("dead"); got.Status != StatusPending || got.Attempts != 0 || queue.Len() != 1 {
+		t.Fatalf("after replay: %s, %d attempts, %d queued; want pending, 0, 1", got.Status, got.Attempts, queue.Len())
+	}
+}
+
+func TestUnknownJobTypeIsDeadLettered(t *testing.T) {
+	s := newServer(t)
+	store.Set(Task{ID: "orphan", Title: "x", Type: "removed", Status: StatusPending, OwnerID: "alice"})
+	inFlight.add("orphan")
+
+	jobs := make(chan Task, 1)
+	jobs <- Task{ID: "orphan", Type: "removed"}
+	close(jobs)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	worker(context.Background(), 1, jobs, store, &wg)
+
+	if inFlight.has("orphan") {
+		t.Fatal("still in flight after a worker took it")
+	}
+	var dead []Task
+	s.do("GET", "/api/dead-letters", nil, &dead)
+	if len(dead) != 1 || dead[0].ID != "orphan" || dead[0].LastError != "unknown job type" {
+		t.Fatalf("dead letters %+v; want the orphan, failed with unknown job type", dead)
+	}
+}
+
+// failingRepo refuses every write.
+type failingRepo struct{ TaskRepository }
+
+func (failingRepo) CompareAndSwap(t Task, _ int64) (Task, error) {
+	return t, errors.New("disk full")
+}
+
+func TestJobErrorReportsFailedSave(t *testing.T) {
+	repo := NewTaskStore()
+	repo.Set(Task{ID: "x", Status: StatusProcessing})
+	task, _ := repo.Get("x")
+
+	for _, attempts := range []int{1, *maxAttempts} {
+		task.Attempts = attempts
+		status, err := handleJobError(context.Background(), failingRepo{repo}, task, errors.New("boom"))
+		if err == nil {
+			t.Errorf("attempt %d: status %q and no error; want the save error", attempts, status)
+		}
+	}
+	if got, _ := repo.Get("x"); got.Status != StatusProcessing || got.LastError != "" {
+		t.Fatalf("after failed saves: %s %q; want untouched", got.Status, got.LastError)
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"taskkit/ids"
+	"taskkit/storage"
+	"taskkit/validate"
+)
+
+// ─── CLOCK ───
+//
+// The scheduler only reads time through Clock, so a fake clock can drive
+// it deterministically.
+
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// ─── SCHEDULES ───
+
+// Schedule creates a new task from its template every time Cron fires.
+type Schedule struct {
+	ID        string     `json:"id" validate:"readonly"`
+	Cron      string     `json:"cron" validate:"required"`
+	Task      Task       `json:"task"` // template: title, type, payload, priority, timeout
+	Enabled   bool       `json:"enabled"`
+	NextRun   time.Time  `json:"nextRun" validate:"readonly"`
+	LastRun   *time.Time `json:"lastRun,omitempty" validate:"readonly"`
+	CreatedAt time.Time  `json:"createdAt" validate:"readonly"`
+}
+
+var schedulesPath = flag.String("schedules", "", "file to persist cron schedules in (default: <data>.schedules with the json/log store)")
+
+// ScheduleStore keeps schedules in memory and, when path is set, mirrors
+// them to a JSON snapshot after every change.
+type ScheduleStore struct {
+	mu    sync.RWMutex
+	items map[string]Schedule
+	path  string
+}
+
+func OpenScheduleStore(path string) (*ScheduleStore, error) {
+	s := &ScheduleStore{items: make(map[string]Schedule), path: path}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	var list []Schedule
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	for _, sc := range list {
+		s.items[sc.ID] = sc
+	}
+	return s, nil
+}
+
+func (s *ScheduleStore) GetAll() []Schedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Schedule, 0, len(s.items))
+	for _, sc := range s.items {
+		list = append(list, sc)
+	}
+	slices.SortFunc(list, func(a, b Schedule) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return list
+}
+
+func (s *ScheduleStore) Get(id string) (Schedule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sc, ok := s.items[id]
+	return sc, ok
+}
+
+func (s *ScheduleStore) Set(sc Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[sc.ID] = sc
+	return s.flush()
+}
+
+func (s *ScheduleStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.items, id)
+	return s.flush()
+}
+
+// flush must be called with mu held.
+func (s *ScheduleStore) flush() error {
+	if s.path == "" {
+		return nil
+	}
+	list := make([]Schedule, 0, len(s.items))
+	for _, sc := range s.items {
+		list = append(list, sc)
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding schedules: %w", err)
+	}
+	return storage.WriteFileAtomic(s.path, data)
+}
+
+// ─── SCHEDULER ───
+//
+// One goroutine sleeps until the earliest due time in a min-heap, then
+// releases delayed tasks (runAt) and fires cron schedules. Heap entries
+// are never removed early: when a task is cancelled or a schedule edited,
+// the stale entry is simply ignored when it comes due, because it no
+// longer matches the task's RunAt or the schedule's NextRun.
+
+type dueItem struct {
+	at         time.Time
+	taskKey    string // set for a delayed task: its store key
+	scheduleID string // set for a cron schedule
+}
+
+type dueHeap []dueItem
+
+func (h dueHeap) Len() int           { return len(h) }
+func (h dueHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h dueHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *dueHeap) Push(x any)        { *h = append(*h, x.(dueItem)) }
+func (h *dueHeap) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}
+
+type Scheduler struct {
+	clock     Clock
+	tasks     TaskRepository
+	schedules *ScheduleStore
+	release   func(Task) bool // hands a due task to the workers
+
+	mu   sync.Mutex
+	due  dueHeap
+	wake chan struct{}
+}
+
+var (
+	schedules *ScheduleStore
+	scheduler *Scheduler
+)
+
+func NewScheduler(clock Clock, tasks TaskRepository, schedules *ScheduleStore, release func(Task) bool) *Scheduler {
+	s := &Scheduler{
+		clock:     clock,
+		tasks:     tasks,
+		schedules: schedules,
+		release:   release,
+		wake:      make(chan struct{}, 1),
+	}
+	// Pending tasks with a runAt are the scheduler's (recoverUnfinished
+	// skips them); past-due ones fire on the first tick.
+	for _, t := range tasks.GetAll() {
+		if t.Status == StatusPending && t.RunAt != nil {
+			s.AddTask(t)
+		}
+	}
+	for _, sc := range schedules.GetAll() {
+		if sc.Enabled {
+			s.AddSchedule(sc)
+		}
+	}
+	return s
+}
+
+func (s *Scheduler) push(it dueItem) {
+	s.mu.Lock()
+	heap.Push(&s.due, it)
+	s.mu.Unlock()
+	notify(s.wake)
+}
+
+func (s *Scheduler) AddTask(t Task) {
+	s.push(dueItem{at: *t.RunAt, taskKey: t.key()})
+}
+
+func (s *Scheduler) AddSchedule(sc Schedule) {
+	s.push(dueItem{at: sc.NextRun, scheduleID: sc.ID})
+}
+
+// Run loops until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		s.mu.Lock()
+		var timer <-chan time.Time
+		if len(s.due) > 0 {
+			timer = s.clock.After(s.due[0].at.Sub(s.clock.Now()))
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-timer:
+			s.Tick()
+		}
+	}
+}
+
+// Tick fires everything due at or before the clock's current time.
+func (s *Scheduler) Tick() {
+	now := s.clock.Now()
+	for {
+		s.mu.Lock()
+		if len(s.due) == 0 || s.due[0].at.After(now) {
+			s.mu.Unlock()
+			return
+		}
+		it := heap.Pop(&s.due).(dueItem)
+		s.mu.Unlock()
+
+		if it.taskKey != "" {
+			s.fireTask(it)
+		} else {
+			s.fireSchedule(it, now)
+		}
+	}
+}
+
+func (s *Scheduler) fireTask(it dueItem) {
+	t, ok := s.tasks.Get(it.taskKey)
+	if !ok || t.Status != StatusPending || t.RunAt == nil || !t.RunAt.Equal(it.at) {
+		return // cancelled, deleted or rescheduled since
+	}
+	if !s.release(t) {
+		taskLog(t).Warn("scheduler: could not queue task; it stays pending")
+	}
+}
+
+func (s *Scheduler) fireSchedule(it dueItem, now time.Time) {
+	sc, ok := s.schedules.Get(it.scheduleID)
+	if !ok || !sc.Enabled || !sc.NextRun.Equal(it.at) {
+		return
+	}
+
+	t := sc.Task
+	t.ID = ids.New()
+	t.ScheduleID = sc.ID
+	t.Status, t.Done = StatusPending, false
+	t.Attempts, t.LastError = 0, ""
+	t.RequestID = ""
+	t.RunAt = nil
+	t.CreatedAt = now
+	// Dependencies are checked per run, as POST /api/tasks would: one
+	// may have failed or been deleted since the schedule was saved.
+	depsMu.Lock()
+	rejected, err := checkDependencies(ownerContext(t), s.tasks, &t)
+	if err == nil {
+		err = s.tasks.Set(t)
+	}
+	depsMu.Unlock()
+	switch {
+	case rejected != 0:
+		slog.Warn("scheduler: skipping run", "schedule_id", sc.ID, "err", err)
+	case err != nil:
+		slog.Error("scheduler: saving task", "schedule_id", sc.ID, "err", err)
+	case !s.release(t):
+		taskLog(t).Warn("scheduler: could not queue task; it stays pending")
+	}
+
+	// A run missed while the server was down fires once, then the
+	// schedule resumes from now rather than replaying every slot.
+	spec, _ := parseCron(sc.Cron) // validated on create/update
+	sc.LastRun = &now
+	sc.NextRun = spec.Next(now)
+	if err := s.schedules.Set(sc); err != nil {
+		slog.Error("scheduler: saving schedule", "schedule_id", sc.ID, "err", err)
+	}
+	if !sc.NextRun.IsZero() {
+		s.AddSchedule(sc)
+	}
+}
+
+// ─── SCHEDULE HANDLERS ───
+
+func writeSchedule(w http.ResponseWriter, status int, sc Schedule) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(sc)
+}
+
+// decodeSchedule reads and validates a schedule body, filling NextRun.
+// create is false for PUT, which may echo server-maintained fields.
+func decodeSchedule(w http.ResponseWriter, r *http.Request, sc *Schedule, create bool) error {
+	sc.Enabled = true // default when the body omits it
+	var spec cronSpec
+	err := validate.WithRules(validate.DecodeJSON(w, r, sc), func() error {
+		errs := validate.Struct(sc, create)
+		var err error
+		spec, err = parseCron(sc.Cron)
+		if err != nil && sc.Cron != "" { // empty is already reported as required
+			errs.Add("cron", err.Error())
+		}
+		var terrs validate.Errors
+		if errors.As(validateTask(&sc.Task, create), &terrs) {
+			errs = append(errs, terrs.Prefixed("task")...)
+		}
+		return errs.Err()
+	})
+	if err != nil {
+		return err
+	}
+	sc.NextRun = spec.Next(scheduler.clock.Now())
+	if sc.NextRun.IsZero() {
+		return validate.Errors{{Field: "cron", Message: "never fires"}}
+	}
+	return nil
+}
+
+// getVisibleSchedule hides schedules whose task template the caller
+// could not see, the same way getVisible does for tasks.
+func getVisibleSchedule(ctx context.Context, id string) (Schedule, bool) {
+	sc, ok := schedules.Get(id)
+	if !ok || !canAccess(ctx, sc.Task) {
+		return Schedule{}, false
+	}
+	return sc, true
+}
+
+func getSchedules(w http.ResponseWriter, r *http.Request) {
+	list := schedules.GetAll()
+	visible := list[:0]
+	for _, sc := range list {
+		if canAccess(r.Context(), sc.Task) {
+			visible = append(visible, sc)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
+}
+
+func getSchedule(w http.ResponseWriter, r *http.Request) {
+	sc, ok := getVisibleSchedule(r.Context(), r.PathValue("id"))
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	writeSchedule(w, http.StatusOK, sc)
+}
+
+func createSchedule(w http.ResponseWriter, r *http.Request) {
+	var sc Schedule
+	if err := decodeSchedule(w, r, &sc, true); err != nil {
+		validate.WriteDecodeError(w, err)
+		return
+	}
+	sc.ID = ids.New()
+	u, _ := UserFrom(r.Context())
+	sc.Task.OwnerID = u.ID
+	sc.Task.ProjectID = projectFrom(r.Context())
+	sc.LastRun = nil
+	sc.CreatedAt = time.Now()
+	if err := schedules.Set(sc); err != nil {
+		http.Error(w, "could not save schedule", http.StatusInternalServerError)
+		return
+	}
+	if sc.Enabled {
+		scheduler.AddSchedule(sc)
+	}
+	writeSchedule(w, http.StatusCreated, sc)
+}
+
+func updateSchedule(w http.ResponseWriter, r *http.Request) {
+	old, ok := getVisibleSchedule(r.Context(), r.PathValue("id"))
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var sc Schedule
+	if err := decodeSchedule(w, r, &sc, false); err != nil {
+		validate.WriteDecodeError(w, err)
+		return
+	}
+	sc.ID, sc.LastRun, sc.CreatedAt = old.ID, old.LastRun, old.CreatedAt
+	sc.Task.OwnerID, sc.Task.ProjectID = old.Task.OwnerID, old.Task.ProjectID
+	if err := schedules.Set(sc); err != nil {
+		http.Error(w, "could not save schedule", http.StatusInternalServerError)
+		return
+	}
+	if sc.Enabled {
+		scheduler.AddSchedule(sc) // the old heap entry no longer matches NextRun
+	}
+	writeSchedule(w, http.StatusOK, sc)
+}
+
+func deleteSchedule(w http.ResponseWriter, r *http.Request) {
+	if _, ok := getVisibleSchedule(r.Context(), r.PathValue("id")); !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	err := schedules.Delete(r.PathValue("id"))
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not delete schedule", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
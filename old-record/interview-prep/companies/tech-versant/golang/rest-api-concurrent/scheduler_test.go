@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ─── FAKE CLOCK ───
+
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock { return &fakeClock{now: now} }
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeTimer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward and fires the timers that came due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = pending
+}
+
+// ─── CRON ───
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		expr, from, want string // want "" = never
+	}{
+		{"* * * * *", "2030-01-01 10:00", "2030-01-01 10:01"},
+		{"*/15 * * * *", "2030-01-01 10:07", "2030-01-01 10:15"},
+		{"5/15 * * * *", "2030-01-01 10:21", "2030-01-01 10:35"},
+		{"0 9 * * *", "2030-01-01 09:00", "2030-01-02 09:00"},   // strictly after
+		{"0 9 * * 1-5", "2030-01-04 10:00", "2030-01-07 09:00"}, // Fri → Mon
+		{"0 0 * * 7", "2030-01-01 00:00", "2030-01-06 00:00"},   // 7 is Sunday
+		{"0 0 1,15 * *", "2030-01-02 00:00", "2030-01-15 00:00"},
+		{"0 0 1 */3 *", "2030-02-10 00:00", "2030-04-01 00:00"},
+		// both day fields restricted: the 13th OR a Friday, whichever is first
+		{"0 0 13 * 5", "2030-01-01 00:00", "2030-01-04 00:00"},
+		{"0 0 13 * 5", "2030-01-12 00:00", "2030-01-13 00:00"},
+		// one day field restricted: only that one counts
+		{"0 0 13 * *", "2030-01-01 00:00", "2030-01-13 00:00"},
+		{"0 0 * * 5", "2030-01-05 00:00", "2030-01-11 00:00"},
+		// a stepped * still counts as unrestricted: odd days AND Mondays
+		{"0 0 */2 * 1", "2030-01-01 00:00", "2030-01-07 00:00"},
+		{"30 2 29 2 *", "2030-03-01 00:00", "2032-02-29 02:30"}, // next leap day
+		{"0 0 30 2 *", "2030-01-01 00:00", ""},
+	}
+	for _, tt := range tests {
+		spec, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tt.expr, err)
+		}
+		got := spec.Next(at(tt.from))
+		if tt.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%q after %s = %s; want never", tt.expr, tt.from, got)
+			}
+			continue
+		}
+		if !got.Equal(at(tt.want)) {
+			t.Errorf("%q after %s = %s; want %s", tt.expr, tt.from, got.Format("2006-01-02 15:04 Mon"), tt.want)
+		}
+	}
+}
+
+func TestParseCronRejects(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) accepted", expr)
+		}
+	}
+}
+
+// ─── SCHEDULER ───
+
+type released struct {
+	mu    sync.Mutex
+	tasks []Task
+	ch    chan Task
+}
+
+func (r *released) release(t Task) bool {
+	r.mu.Lock()
+	r.tasks = append(r.tasks, t)
+	r.mu.Unlock()
+	if r.ch != nil {
+		r.ch <- t
+	}
+	return true
+}
+
+func (r *released) ids() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for _, t := range r.tasks {
+		out = append(out, t.ID)
+	}
+	return out
+}
+
+func newTestScheduler(t *testing.T, clock Clock) (*Scheduler, TaskRepository, *ScheduleStore, *released) {
+	t.Helper()
+	repo := NewTaskStore()
+	scs, err := OpenScheduleStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel := &released{}
+	return NewScheduler(clock, repo, scs, rel.release), repo, scs, rel
+}
+
+func TestSchedulerDelayedTask(t *testing.T) {
+	clock := newFakeClock(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	s, repo, _, rel := newTestScheduler(t, clock)
+
+	runAt := clock.Now().Add(time.Minute)
+	task := Task{ID: "t1", Status: StatusPending, RunAt: &runAt}
+	repo.Set(task)
+	s.AddTask(task)
+
+	clock.Advance(59 * time.Second)
+	s.Tick()
+	if got := rel.ids(); len(got) != 0 {
+		t.Fatalf("released %v before runAt", got)
+	}
+	clock.Advance(time.Second)
+	s.Tick()
+	s.Tick()
+	if got := rel.ids(); len(got) != 1 || got[0] != "t1" {
+		t.Fatalf("released %v at runAt; want [t1] once", got)
+	}
+}
+
+func TestSchedulerCancelAndReschedule(t *testing.T) {
+	clock := newFakeClock(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	s, repo, _, rel := newTestScheduler(t, clock)
+
+	soon, later := clock.Now().Add(time.Minute), clock.Now().Add(time.Hour)
+
+	// cancelled before it came due: its heap entry is ignored
+	cancelled := Task{ID: "cancelled", Status: StatusPending, RunAt: &soon}
+	repo.Set(cancelled)
+	s.AddTask(cancelled)
+	cancelled.Status = StatusCancelled
+	repo.Set(cancelled)
+
+	// moved to later: only the new entry fires
+	moved := Task{ID: "moved", Status: StatusPending, RunAt: &soon}
+	repo.Set(moved)
+	s.AddTask(moved)
+	moved.RunAt = &later
+	repo.Set(moved)
+	s.AddTask(moved)
+
+	clock.Advance(time.Minute)
+	s.Tick()
+	if got := rel.ids(); len(got) != 0 {
+		t.Fatalf("released %v at the old runAt; want none", got)
+	}
+	clock.Advance(time.Hour)
+	s.Tick()
+	if got := rel.ids(); len(got) != 1 || got[0] != "moved" {
+		t.Fatalf("released %v; want [moved]", got)
+	}
+}
+
+func TestSchedulerCronFires(t *testing.T) {
+	start := time.Date(2030, 1, 1, 12, 0, 30, 0, time.UTC)
+	clock := newFakeClock(start)
+	s, repo, scs, rel := newTestScheduler(t, clock)
+
+	spec, _ := parseCron("*/5 * * * *")
+	sc := Schedule{ID: "s1", Cron: "*/5 * * * *", Task: Task{Title: "tick"}, Enabled: true, NextRun: spec.Next(start)}
+	scs.Set(sc)
+	s.AddSchedule(sc)
+
+	for range 3 {
+		clock.Advance(5 * time.Minute)
+		s.Tick()
+	}
+	if n := len(rel.ids()); n != 3 {
+		t.Fatalf("fired %d times in 15 minutes of */5; want 3", n)
+	}
+	for _, task := range rel.tasks {
+		stored, ok := repo.Get(task.ID)
+		if !ok || stored.ScheduleID != "s1" || stored.Status != StatusPending || stored.Title != "tick" {
+			t.Fatalf("created task %+v, %v; want a pending copy of the template", stored, ok)
+		}
+	}
+	got, _ := scs.Get("s1")
+	if want := time.Date(2030, 1, 1, 12, 20, 0, 0, time.UTC); !got.NextRun.Equal(want) {
+		t.Fatalf("NextRun = %s; want %s", got.NextRun, want)
+	}
+	if got.LastRun == nil || !got.LastRun.Equal(clock.Now()) {
+		t.Fatalf("LastRun = %v; want %s", got.LastRun, clock.Now())
+	}
+}
+
+func TestSchedulerMissedFiresRunOnce(t *testing.T) {
+	clock := newFakeClock(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	_, _, scs, rel := newTestScheduler(t, clock)
+
+	// persisted while the server was down for an hour: 12 slots missed
+	sc := Schedule{ID: "s1", Cron: "*/5 * * * *", Enabled: true, NextRun: clock.Now().Add(-time.Hour)}
+	scs.Set(sc)
+	clock.Advance(30 * time.Second)
+
+	// reloading the store is what a restart does
+	s := NewScheduler(clock, NewTaskStore(), scs, rel.release)
+	s.Tick()
+	if n := len(rel.ids()); n != 1 {
+		t.Fatalf("fired %d times for missed slots; want 1", n)
+	}
+	got, _ := scs.Get("s1")
+	if want := time.Date(2030, 1, 1, 12, 5, 0, 0, time.UTC); !got.NextRun.Equal(want) {
+		t.Fatalf("NextRun = %s; want %s (resumes from now)", got.NextRun, want)
+	}
+}
+
+func TestSchedulerDisabledAndEditedSchedules(t *testing.T) {
+	clock := newFakeClock(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	s, _, scs, rel := newTestScheduler(t, clock)
+
+	off := Schedule{ID: "off", Cron: "* * * * *", Enabled: true, NextRun: clock.Now().Add(time.Minute)}
+	scs.Set(off)
+	s.AddSchedule(off)
+	off.Enabled = false
+	scs.Set(off)
+
+	edited := Schedule{ID: "edited", Cron: "* * * * *", Enabled: true, NextRun: clock.Now().Add(time.Minute)}
+	scs.Set(edited)
+	s.AddSchedule(edited)
+	edited.Cron, edited.NextRun = "0 13 * * *", time.Date(2030, 1, 1, 13, 0, 0, 0, time.UTC)
+	scs.Set(edited)
+	s.AddSchedule(edited)
+
+	clock.Advance(time.Minute)
+	s.Tick()
+	if got := rel.ids(); len(got) != 0 {
+		t.Fatalf("released %v; disabled and edited schedules should not fire at the old time", got)
+	}
+	clock.Advance(time.Hour)
+	s.Tick()
+	if n := len(rel.ids()); n != 1 {
+		t.Fatalf("fired %d times at the edited time; want 1", n)
+	}
+	if err := scs.Delete("edited"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(24 * time.Hour)
+	s.Tick()
+	if n := len(rel.ids()); n != 1 {
+		t.Fatalf("a deleted schedule fired; %d releases", n)
+	}
+}
+
+func TestSchedulerRunWakesOnClock(t *testing.T) {
+	clock := newFakeClock(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	s, repo, _, rel := newTestScheduler(t, clock)
+	rel.ch = make(chan Task, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	runAt := clock.Now().Add(time.Minute)
+	task := Task{ID: "t1", Status: StatusPending, RunAt: &runAt}
+	repo.Set(task)
+	s.AddTask(task)
+
+	// Run re-arms its timer after AddTask wakes it; keep nudging the
+	// clock until the timer for runAt exists and fires
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-rel.ch:
+			if got.ID != "t1" {
+				t.Fatalf("released %s; want t1", got.ID)
+			}
+			return
+		case <-deadline:
+			t.Fatal("Run never released the task")
+		case <-time.After(10 * time.Millisecond):
+			if clock.Now().Before(runAt) {
+				clock.Advance(time.Minute)
+			} else {
+				clock.Advance(0)
+			}
+		}
+	}
+}
+
+func TestScheduleChecksDependenciesPerRun(t *testing.T) {
+	newServer(t)
+	clock := newFakeClock(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	rel := &released{}
+	s := NewScheduler(clock, store, schedules, rel.release)
+
+	store.Set(Task{ID: "open", Status: StatusPending, OwnerID: "alice"})
+	store.Set(Task{ID: "dead", Status: StatusFailed, OwnerID: "alice"})
+	store.Set(Task{ID: "bobs", Status: StatusPending, OwnerID: "bob"})
+	for id, dep := range map[string]string{"ok": "open", "ended": "dead", "hidden": "bobs"} {
+		sc := Schedule{ID: id, Cron: "* * * * *", Enabled: true, NextRun: clock.Now().Add(time.Minute),
+			Task: Task{Title: id, OwnerID: "alice", DependsOn: []string{dep}}}
+		schedules.Set(sc)
+		s.AddSchedule(sc)
+	}
+
+	clock.Advance(time.Minute)
+	s.Tick()
+	if got := rel.tasks; len(got) != 1 || got[0].ScheduleID != "ok" {
+		t.Fatalf("released %+v; want only the run of ok", got)
+	}
+	if n := len(store.GetAll()); n != 4 {
+		t.Fatalf("%d tasks stored; want the 3 dependencies and ok's run", n)
+	}
+	if sc, _ := schedules.Get("ended"); !sc.NextRun.After(clock.Now()) {
+		t.Fatalf("a skipped run did not advance its schedule: NextRun %s", sc.NextRun)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ─── STATUS STATE MACHINE ───
+//
+//   pending ──► processing ──► completed
+//      ▲            ├────────► timed_out
+//      │            ├────────► failed     (attempts exhausted)
+//      └─ retry ────┤
+//      └────────────┴────────► cancelled
+//
+// A pending task whose job type is unknown goes straight to failed.
+//
+// completed, cancelled, timed_out and failed are terminal.
+
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusCancelled  = "cancelled"
+	StatusTimedOut   = "timed_out"
+	StatusFailed     = "failed"
+)
+
+var transitions = map[string][]string{
+	StatusPending:    {StatusProcessing, StatusCancelled, StatusFailed},
+	StatusProcessing: {StatusCompleted, StatusCancelled, StatusTimedOut, StatusFailed, StatusPending},
+}
+
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+func canTransition(from, to string) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+func isTerminal(status string) bool {
+	return len(transitions[status]) == 0
+}
+
+// open reports whether t can still run; only open tasks are overdue or
+// get reminders. Trashed tasks never run.
+func (t Task) open() bool { return !isTerminal(t.Status) && !t.trashed() }
+
+// transitionMu makes read-check-write of a status atomic, so a cancel
+// request and a worker picking up the same task can't both win.
+var transitionMu sync.Mutex
+
+// transition moves the task stored under key to status to, enforcing the state machine.
+// edits run on the task before it is saved, under the same lock.
+func transition(store TaskRepository, key, to string, edits ...func(*Task)) (Task, error) {
+	return transitionIf(store, key, nil, to, edits...)
+}
+
+// transitionIf is transition with a precondition: when match rejects the
+// current task (a client's stale If-Match) it returns ErrVersionConflict.
+// The save is a CompareAndSwap, so a write that bypassed transitionMu in
+// the meantime is not overwritten either. Once saved, the task's
+// dependents are settled (see deps.go).
+func transitionIf(store TaskRepository, key string, match func(Task) bool, to string, edits ...func(*Task)) (Task, error) {
+	t, err := transitionLocked(store, key, match, to, edits...)
+	if err == nil {
+		settleDependents(store, t)
+	}
+	return t, err
+}
+
+func transitionLocked(store TaskRepository, key string, match func(Task) bool, to string, edits ...func(*Task)) (Task, error) {
+	transitionMu.Lock()
+	defer transitionMu.Unlock()
+
+	t, ok := store.Get(key)
+	if !ok {
+		return t, ErrNotFound
+	}
+	if match != nil && !match(t) {
+		return t, ErrVersionConflict
+	}
+	if !canTransition(t.Status, to) {
+		return t, fmt.Errorf("%s → %s: %w", t.Status, to, ErrInvalidTransition)
+	}
+	version := t.Version
+	t.Status = to
+	t.Done = to == StatusCompleted
+	for _, edit := range edits {
+		edit(&t)
+	}
+	saved, err := store.CompareAndSwap(t, version)
+	if err != nil {
+		return t, err
+	}
+	return saved, nil
+}
@@ -1,7 +1,12 @@
 # ─── TEST CONCURRENT REST API ───
-# Terminal 1: go run main.go
+# Terminal 1: go run .
 # Terminal 2: .\test.ps1
 
+# Every /api call authenticates as alice (demo key); -Headers below adds to it.
+$auth = @{ "X-API-Key" = "alice-key" }
+$PSDefaultParameterValues["Invoke-RestMethod:Headers"] = $auth
+$PSDefaultParameterValues["Invoke-WebRequest:Headers"] = $auth
+
 Write-Host "═══ POST 3 tasks (they'll process concurrently) ═══" -ForegroundColor Cyan
 $body1 = @{ title = "Task Alpha" } | ConvertTo-Json
 $body2 = @{ title = "Task Beta" } | ConvertTo-Json
@@ -19,3 +24,154 @@ Start-Sleep -Seconds 3
 
 Write-Host "═══ GET all (should show completed) ═══" -ForegroundColor Green
 Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method GET | ConvertTo-Json
+
+Write-Host "`n═══ GET completed, sorted by title, 2 per page ═══" -ForegroundColor Cyan
+$page = Invoke-WebRequest -Uri "http://localhost:8080/api/tasks?status=completed&sort=title&limit=2" -Method GET
+$page.Content
+Write-Host "next token: $($page.Headers['X-Next-Cursor'])"
+
+Write-Host "`n═══ Queue depth ═══" -ForegroundColor Cyan
+Invoke-RestMethod -Uri http://localhost:8080/api/queue -Method GET | ConvertTo-Json
+
+Write-Host "`n═══ Cancel a running task / let one time out ═══" -ForegroundColor Cyan
+$slow = Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Cancel me" } | ConvertTo-Json) -ContentType "application/json"
+$fast = Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Too slow"; timeout = "500ms" } | ConvertTo-Json) -ContentType "application/json"
+Invoke-RestMethod -Uri "http://localhost:8080/api/tasks/$($slow.id)/cancel" -Method POST | ConvertTo-Json
+Start-Sleep -Seconds 1
+Invoke-RestMethod -Uri "http://localhost:8080/api/tasks/$($fast.id)" -Method GET | ConvertTo-Json   # status: timed_out
+
+Write-Host "`n═══ Dead letters (run server with -fail-rate=1 to populate) ═══" -ForegroundColor Cyan
+$dead = Invoke-RestMethod -Uri http://localhost:8080/api/dead-letters -Method GET
+$dead | ConvertTo-Json
+if ($dead.Count -gt 0) {
+    Invoke-RestMethod -Uri "http://localhost:8080/api/dead-letters/$($dead[0].id)/replay" -Method POST | ConvertTo-Json
+}
+
+Write-Host "`n═══ Typed jobs: 3 slow reports (limit 1) don't block emails ═══" -ForegroundColor Cyan
+1..3 | ForEach-Object {
+    $body = @{ title = "Report $_"; type = "report"; payload = @{ name = "q$_"; format = "csv" } } | ConvertTo-Json
+    Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body $body -ContentType "application/json" | Out-Null
+}
+$body = @{ title = "Welcome mail"; type = "email"; payload = @{ to = "dev@example.com"; subject = "Hi" } } | ConvertTo-Json
+Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body $body -ContentType "application/json" | ConvertTo-Json
+Invoke-RestMethod -Uri http://localhost:8080/api/job-types -Method GET | ConvertTo-Json
+
+Write-Host "`n═══ Priority: a priority-9 task jumps the queue ═══" -ForegroundColor Cyan
+1..5 | ForEach-Object {
+    Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Low $_" } | ConvertTo-Json) -ContentType "application/json" | Out-Null
+}
+Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Urgent"; priority = 9 } | ConvertTo-Json) -ContentType "application/json" | ConvertTo-Json
+Write-Host "Watch the server log: Urgent is processed before Low 4 / Low 5 (ordering under concurrent producers: go test -run Queue)" -ForegroundColor Yellow
+
+Write-Host "`n═══ Delayed task (runs in 5s) and a cron schedule (every minute) ═══" -ForegroundColor Cyan
+$runAt = (Get-Date).ToUniversalTime().AddSeconds(5).ToString("o")
+Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Later"; runAt = $runAt } | ConvertTo-Json) -ContentType "application/json" | ConvertTo-Json
+$body = @{ cron = "* * * * *"; task = @{ title = "Heartbeat mail"; type = "email"; payload = @{ to = "ops@example.com"; subject = "tick" } } } | ConvertTo-Json -Depth 4
+$sched = Invoke-RestMethod -Uri http://localhost:8080/api/schedules -Method POST -Body $body -ContentType "application/json"
+$sched | ConvertTo-Json -Depth 4
+Invoke-RestMethod -Uri http://localhost:8080/api/schedules -Method GET | ConvertTo-Json -Depth 4
+Invoke-WebRequest -Uri "http://localhost:8080/api/schedules/$($sched.id)" -Method DELETE | Select-Object StatusCode
+
+Write-Host "`n═══ X-Request-ID: stamped on the task and on its worker log lines ═══" -ForegroundColor Cyan
+$body = @{ title = "Traced" } | ConvertTo-Json
+Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body $body -ContentType "application/json" -Headers ($auth + @{ "X-Request-ID" = "demo-req-1" }) | ConvertTo-Json
+Write-Host "Watch the server log: request_id=demo-req-1 on the access and worker lines" -ForegroundColor Yellow
+
+Write-Host "`n═══ Metrics: queue depth, busy/idle workers, task durations ═══" -ForegroundColor Cyan
+(Invoke-WebRequest -Uri http://localhost:8080/metrics -Method GET).Content -split "`n" | Where-Object { $_ -match '^(jobs_|worker_pool_|task_duration_seconds_count)' }
+
+Write-Host "`n═══ Ownership: bob can't see or cancel alice's tasks ═══" -ForegroundColor Cyan
+$mine = Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Alice only"; runAt = (Get-Date).ToUniversalTime().AddMinutes(5).ToString("o") } | ConvertTo-Json) -ContentType "application/json"
+try { Invoke-RestMethod -Uri "http://localhost:8080/api/tasks/$($mine.id)/cancel" -Method POST -Headers @{ "X-API-Key" = "bob-key" } } catch { $_.Exception.Response.StatusCode }
+(Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method GET -Headers @{ "X-API-Key" = "admin-key" }).Count
+
+Write-Host "`n═══ Rate limit: burst of POSTs until 429 ═══" -ForegroundColor Cyan
+foreach ($i in 1..15) {
+    try {
+        $r = Invoke-WebRequest -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Burst $i" } | ConvertTo-Json) -ContentType "application/json"
+        "$i → $($r.StatusCode) remaining=$($r.Headers['X-RateLimit-Remaining'])"
+    } catch {
+        "$i → $([int]$_.Exception.Response.StatusCode) Retry-After=$($_.Exception.Response.Headers['Retry-After'])"
+    }
+}
+
+Write-Host "`n═══ Validation: every field error in one application/problem+json ═══" -ForegroundColor Cyan
+try {
+    Invoke-WebRequest -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = ""; status = "completed"; priority = 12; extra = 1 } | ConvertTo-Json) -ContentType "application/json"
+} catch {
+    $_.ErrorDetails.Message
+}
+
+Write-Host "`n═══ Idempotency-Key: retried POST returns the same task ═══" -ForegroundColor Cyan
+$key = [guid]::NewGuid().ToString()
+$first = Invoke-WebRequest -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Exactly once" } | ConvertTo-Json) -ContentType "application/json" -Headers @{ "Idempotency-Key" = $key }
+$again = Invoke-WebRequest -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Exactly once" } | ConvertTo-Json) -ContentType "application/json" -Headers @{ "Idempotency-Key" = $key }
+"$(($first.Content | ConvertFrom-Json).id) == $(($again.Content | ConvertFrom-Json).id)  replayed=$($again.Headers['Idempotent-Replayed'])"
+try {
+    Invoke-WebRequest -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Something else" } | ConvertTo-Json) -ContentType "application/json" -Headers @{ "Idempotency-Key" = $key }
+} catch {
+    "different body → $([int]$_.Exception.Response.StatusCode)"
+}
+
+Write-Host "`n═══ ETags: 304 on If-None-Match, 412 on a stale If-Match ═══" -ForegroundColor Cyan
+$later = Invoke-WebRequest -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Versioned"; runAt = (Get-Date).ToUniversalTime().AddMinutes(5).ToString("o") } | ConvertTo-Json) -ContentType "application/json"
+$id = ($later.Content | ConvertFrom-Json).id
+$tag = $later.Headers['ETag']
+try { Invoke-WebRequest -Uri "http://localhost:8080/api/tasks/$id" -Method GET -Headers @{ "If-None-Match" = $tag } } catch { "If-None-Match $tag → $([int]$_.Exception.Response.StatusCode)" }
+try { Invoke-WebRequest -Uri "http://localhost:8080/api/tasks/$id/cancel" -Method POST -Headers @{ "If-Match" = '"999"' } } catch { "If-Match `"999`" → $([int]$_.Exception.Response.StatusCode)" }
+$r = Invoke-WebRequest -Uri "http://localhost:8080/api/tasks/$id/cancel" -Method POST -Headers @{ "If-Match" = $tag }
+"If-Match $tag → $($r.StatusCode), new ETag $($r.Headers['ETag'])"
+
+Write-Host "`n═══ Tags and due dates: ?tag= uses the index, ?overdue=true ═══" -ForegroundColor Cyan
+Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Late report"; tags = @("Reports", "ops"); dueAt = (Get-Date).ToUniversalTime().AddHours(-1).ToString("o"); runAt = (Get-Date).ToUniversalTime().AddMinutes(5).ToString("o") } | ConvertTo-Json) -ContentType "application/json" | ConvertTo-Json
+(Invoke-RestMethod -Uri "http://localhost:8080/api/tasks?tag=reports" -Method GET).title
+(Invoke-RestMethod -Uri "http://localhost:8080/api/tasks?overdue=true" -Method GET).title
+
+Write-Host "`n═══ Dependencies: B waits for A, a cycle is 409, cancelling A cascades ═══" -ForegroundColor Cyan
+$a = Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Extract"; runAt = (Get-Date).ToUniversalTime().AddMinutes(5).ToString("o") } | ConvertTo-Json) -ContentType "application/json"
+$b = Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Transform"; dependsOn = @($a.id) } | ConvertTo-Json) -ContentType "application/json"
+$c = Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Load"; dependsOn = @($b.id) } | ConvertTo-Json) -ContentType "application/json"
+try {
+    Invoke-WebRequest -Uri "http://localhost:8080/api/tasks/$($b.id)/dependencies" -Method PUT -Body (@{ dependsOn = @($c.id) } | ConvertTo-Json) -ContentType "application/json"
+} catch {
+    "cycle → $([int]$_.Exception.Response.StatusCode): $($_.ErrorDetails.Message)"
+}
+Invoke-RestMethod -Uri "http://localhost:8080/api/tasks/$($b.id)/graph" -Method GET | ConvertTo-Json -Depth 4
+Invoke-RestMethod -Uri "http://localhost:8080/api/tasks/$($a.id)/cancel" -Method POST | Out-Null
+Start-Sleep -Milliseconds 200
+Invoke-RestMethod -Uri "http://localhost:8080/api/tasks/$($c.id)" -Method GET | Select-Object title, status, lastError
+
+Write-Host "`n═══ Projects: isolated task lists, 404 across projects, archive refuses writes ═══" -ForegroundColor Cyan
+$p1 = Invoke-RestMethod -Uri http://localhost:8080/api/projects -Method POST -Body (@{ name = "Acme" } | ConvertTo-Json) -ContentType "application/json"
+$p2 = Invoke-RestMethod -Uri http://localhost:8080/api/projects -Method POST -Body (@{ name = "Globex"; quota = 1 } | ConvertTo-Json) -ContentType "application/json"
+$t1 = Invoke-RestMethod -Uri "http://localhost:8080/api/projects/$($p1.id)/tasks" -Method POST -Body (@{ title = "Acme only" } | ConvertTo-Json) -ContentType "application/json"
+foreach ($url in "http://localhost:8080/api/projects/$($p2.id)/tasks/$($t1.id)", "http://localhost:8080/api/tasks/$($t1.id)") {
+    try { Invoke-RestMethod -Uri $url -Method GET; "LEAK: $url" } catch { "$url → $([int]$_.Exception.Response.StatusCode)" }
+}
+(Invoke-RestMethod -Uri "http://localhost:8080/api/projects/$($p2.id)/tasks" -Method GET).Count
+try { Invoke-RestMethod -Uri "http://localhost:8080/api/projects/$($p1.id)/tasks" -Method GET -Headers @{ "X-API-Key" = "bob-key" } } catch { "bob → $([int]$_.Exception.Response.StatusCode)" }
+Invoke-RestMethod -Uri "http://localhost:8080/api/projects/$($p1.id)/archive" -Method POST | Select-Object name, archivedAt
+try {
+    Invoke-RestMethod -Uri "http://localhost:8080/api/projects/$($p1.id)/tasks" -Method POST -Body (@{ title = "Too late" } | ConvertTo-Json) -ContentType "application/json"
+} catch {
+    "archived → $([int]$_.Exception.Response.StatusCode)"
+}
+Invoke-WebRequest -Uri "http://localhost:8080/api/projects/$($p1.id)" -Method DELETE | Select-Object StatusCode
+Invoke-RestMethod -Uri http://localhost:8080/api/projects -Method GET | Select-Object name, limit, active, parked
+
+Write-Host "`n═══ Trash: DELETE hides a task, GET /api/trash lists it, restore brings it back ═══" -ForegroundColor Cyan
+$gone = Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Oops"; runAt = (Get-Date).ToUniversalTime().AddMinutes(5).ToString("o") } | ConvertTo-Json) -ContentType "application/json"
+Invoke-WebRequest -Uri "http://localhost:8080/api/tasks/$($gone.id)" -Method DELETE | Select-Object StatusCode
+try { Invoke-RestMethod -Uri "http://localhost:8080/api/tasks/$($gone.id)" -Method GET } catch { "trashed → $([int]$_.Exception.Response.StatusCode)" }
+Invoke-RestMethod -Uri http://localhost:8080/api/trash -Method GET | Select-Object title, status, deletedAt
+Invoke-RestMethod -Uri "http://localhost:8080/api/tasks/$($gone.id)/restore" -Method POST | Select-Object title, status, deletedAt
+
+Write-Host "`n═══ History: who changed what, and the task as it was ═══" -ForegroundColor Cyan
+$audited = Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Audited" } | ConvertTo-Json) -ContentType "application/json"
+Start-Sleep -Milliseconds 500
+$before = (Get-Date).ToUniversalTime().ToString("o")
+Start-Sleep -Seconds 3
+Invoke-RestMethod -Uri "http://localhost:8080/api/tasks/$($audited.id)/history" -Method GET | ForEach-Object {
+    "v$($_.version) $($_.op) by $($_.actor.source)$(if ($_.actor.userId) { ":" + $_.actor.userId }): $(($_.changes | ForEach-Object { $_.field }) -join ', ')"
+}
+Invoke-RestMethod -Uri "http://localhost:8080/api/tasks/$($audited.id)/history?at=$before" -Method GET | Select-Object title, status, version
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"taskkit/etag"
+)
+
+// ─── TRASH (SOFT DELETE) ───
+//
+// DELETE /api/tasks/{id} only stamps DeletedAt. A trashed task keeps its
+// status but disappears from every normal view (getVisible, visibleTasks)
+// and is never run: the worker's pending → processing transition refuses
+// it. GET /api/trash lists it, POST /api/tasks/{id}/restore clears the
+// stamp and re-queues it if it is ready to run, and purgeLoop removes it
+// for good after -trash-retention.
+//
+// A running task can't be trashed; cancel it first (409). A trashed
+// dependency counts as broken: pending tasks waiting on it are cancelled
+// when it is trashed, and restoring it does not bring them back. Like
+// every other task route these exist per project too (see projects.go).
+
+var (
+	trashRetention = flag.Duration("trash-retention", 30*24*time.Hour, "how long trashed tasks can be restored before they are purged (0 = keep forever)")
+	purgeEvery     = flag.Duration("purge-every", time.Hour, "how often trashed tasks past -trash-retention are purged")
+)
+
+var errTaskRunning = errors.New("task is running; cancel it first")
+
+func (t Task) trashed() bool { return t.DeletedAt != nil }
+
+// setTrashed stamps or clears DeletedAt on the task stored under key.
+// Under transitionMu, so a worker can't start the task between the check
+// and the save.
+func setTrashed(ctx context.Context, key string, trash bool, match func(Task) bool) (Task, error) {
+	transitionMu.Lock()
+	defer transitionMu.Unlock()
+
+	t, ok := store.Get(key)
+	if !ok || t.trashed() == trash {
+		return t, ErrNotFound
+	}
+	if match != nil && !match(t) {
+		return t, ErrVersionConflict
+	}
+	if trash && t.Status == StatusProcessing {
+		return t, errTaskRunning
+	}
+	version := t.Version
+	if trash {
+		now := time.Now()
+		t.DeletedAt = &now
+	} else {
+		t.DeletedAt = nil
+	}
+	saved, err := withActor(store, actorFrom(ctx)).CompareAndSwap(t, version)
+	if err != nil {
+		return t, err
+	}
+	return saved, nil
+}
+
+// ─── HANDLERS ───
+
+// deleteTask is DELETE /api/tasks/{id}: the task moves to the trash.
+// If-Match is honoured (412).
+func deleteTask(w http.ResponseWriter, r *http.Request) {
+	t, ok := getVisible(r.Context(), r.PathValue("id"))
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	t, err := setTrashed(r.Context(), t.key(), true, func(t Task) bool { return etag.IfMatch(r, t.Version) })
+	if !writeTrashError(w, r, t, err) {
+		return
+	}
+	settleDependents(withActor(store, actorFrom(r.Context())), t)
+	logFrom(r.Context()).Info("task trashed", "task_id", t.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restoreTask is POST /api/tasks/{id}/restore. A pending task goes back to
+// the queue, or to waiting on its dependencies or its runAt. One trashed
+// while queued may still be there, and then runs from that entry.
+func restoreTask(w http.ResponseWriter, r *http.Request) {
+	t, ok := getTrashed(r.Context(), r.PathValue("id"))
+	if !ok {
+		http.Error(w, "not in trash", http.StatusNotFound)
+		return
+	}
+	t, err := setTrashed(r.Context(), t.key(), false, func(t Task) bool { return etag.IfMatch(r, t.Version) })
+	if !writeTrashError(w, r, t, err) {
+		return
+	}
+	// a runAt still ahead is the scheduler's; one that passed fired
+	// while the task was trashed and was skipped by the worker
+	if t.Status == StatusPending && ready(store, t) && !inFlight.has(t.key()) && !requeue(r.Context(), t) {
+		taskLog(t).Warn("could not queue restored task; it stays pending")
+	}
+	logFrom(r.Context()).Info("task restored", "task_id", t.ID)
+	w.Header().Set("ETag", etag.Of(t.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// writeTrashError answers a setTrashed failure and reports whether err
+// was nil.
+func writeTrashError(w http.ResponseWriter, r *http.Request, t Task, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, ErrVersionConflict) && r.Header.Get("If-Match") != "":
+		http.Error(w, "If-Match does not match the current ETag "+etag.Of(t.Version), http.StatusPreconditionFailed)
+	case errors.Is(err, ErrVersionConflict), errors.Is(err, errTaskRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "could not save task", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// getTrashed is getVisible for the trash.
+func getTrashed(ctx context.Context, id string) (Task, bool) {
+	t, ok := store.Get(taskKey(projectFrom(ctx), id))
+	if !ok || !t.trashed() || !canAccess(ctx, t) {
+		return Task{}, false
+	}
+	return t, true
+}
+
+// getTrash is GET /api/trash: the caller's trashed tasks, most recently
+// deleted first.
+func getTrash(w http.ResponseWriter, r *http.Request) {
+	list := []Task{}
+	for _, t := range store.GetAll() {
+		if t.trashed() && canAccess(r.Context(), t) {
+			list = append(list, t)
+		}
+	}
+	slices.SortFunc(list, func(a, b Task) int {
+		return cmp.Or(b.DeletedAt.Compare(*a.DeletedAt), cmp.Compare(a.ID, b.ID))
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// ─── PURGER ───
+
+// purgeTrash hard-deletes tasks trashed before now-retention. Pending
+// tasks that depended on one can never run, so they are cancelled.
+func purgeTrash(repo TaskRepository, retention time.Duration, now time.Time) int {
+	var purged []string
+	for _, t := range repo.GetAll() {
+		if !t.trashed() || now.Sub(*t.DeletedAt) < retention {
+			continue
+		}
+		if err := repo.Delete(t.key()); err != nil && !errors.Is(err, ErrNotFound) {
+			taskLog(t).Error("purging task", "err", err)
+			continue
+		}
+		purged = append(purged, t.key())
+	}
+	for _, d := range repo.GetAll() {
+		if d.Status != StatusPending || !slices.ContainsFunc(d.DependsOn, func(id string) bool { return slices.Contains(purged, taskKey(d.ProjectID, id)) }) {
+			continue
+		}
+		if _, broken := waitState(repo, d); broken != "" {
+			cancelDependent(repo, d.key(), broken)
+		}
+	}
+	return len(purged)
+}
+
+func purgeLoop(ctx context.Context, repo TaskRepository, retention, every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			if n := purgeTrash(repo, retention, now); n > 0 {
+				slog.Info("purged trashed tasks", "count", n)
+			}
+			// purged tasks, and those of deleted projects, leave history
+			if r, ok := repo.(auditRepo); ok {
+				if err := r.history.Compact(); err != nil {
+					slog.Error("compacting history", "err", err)
+				}
+			}
+		}
+	}
+}
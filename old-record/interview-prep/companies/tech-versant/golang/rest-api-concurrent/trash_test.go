@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRestoreDoesNotQueueTwice(t *testing.T) {
+	s := newServer(t)
+	var task Task
+	s.do("POST", "/api/tasks", map[string]any{"title": "x"}, &task)
+	if queue.Len() != 1 {
+		t.Fatalf("queue holds %d tasks after create; want 1", queue.Len())
+	}
+
+	// restored before a worker reached it: the queued copy runs it
+	s.do("DELETE", "/api/tasks/"+task.ID, nil, nil)
+	if code := s.do("POST", "/api/tasks/"+task.ID+"/restore", nil, nil); code != http.StatusOK {
+		t.Fatalf("restore: %d", code)
+	}
+	if queue.Len() != 1 {
+		t.Fatalf("queue holds %d tasks after a restore while queued; want 1", queue.Len())
+	}
+
+	// restored after a worker dropped it: queued again
+	s.do("DELETE", "/api/tasks/"+task.ID, nil, nil)
+	it, _, _ := queue.pop()
+	process(context.Background(), 1, it.task, store)
+	if inFlight.has(task.key()) {
+		t.Fatal("still in flight after a worker took it")
+	}
+	s.do("POST", "/api/tasks/"+task.ID+"/restore", nil, nil)
+	if queue.Len() != 1 {
+		t.Fatalf("queue holds %d tasks after a restore of a dropped task; want 1", queue.Len())
+	}
+}
+
+func TestTrashedDependencyCancelsDependents(t *testing.T) {
+	s := newServer(t)
+	var dep, waiting Task
+	s.do("POST", "/api/tasks", map[string]any{"title": "dep"}, &dep)
+	s.do("POST", "/api/tasks", map[string]any{"title": "waiting", "dependsOn": []string{dep.ID}}, &waiting)
+
+	s.do("DELETE", "/api/tasks/"+dep.ID, nil, nil)
+	got, _ := store.Get(waiting.key())
+	if got.Status != StatusCancelled || !strings.Contains(got.LastError, "trash") {
+		t.Fatalf("dependent after its dependency was trashed: %s %q; want cancelled", got.Status, got.LastError)
+	}
+	if _, broken := waitState(store, Task{DependsOn: []string{dep.ID}}); broken == "" {
+		t.Fatal("waitState does not treat a trashed dependency as broken")
+	}
+
+	// restoring the dependency leaves the dependent cancelled
+	s.do("POST", "/api/tasks/"+dep.ID+"/restore", nil, nil)
+	if got, _ := store.Get(waiting.key()); got.Status != StatusCancelled {
+		t.Fatalf("dependent after restore: %s; want still cancelled", got.Status)
+	}
+}
+
+func TestTrashIsHiddenFromEvents(t *testing.T) {
+	s := newServer(t)
+	events, _, _ := broker.Subscribe(0)
+	var task Task
+	s.do("POST", "/api/tasks", map[string]any{"title": "x"}, &task)
+	s.do("DELETE", "/api/tasks/"+task.ID, nil, nil)
+	// writes while in the trash, e.g. a cascade, are not published
+	transition(store, task.key(), StatusCancelled)
+	s.do("POST", "/api/tasks/"+task.ID+"/restore", nil, nil)
+	trashed, _ := store.Get(task.key())
+	trashed.DeletedAt = &trashed.UpdatedAt
+	store.Set(trashed)
+	store.Delete(task.key()) // the purger
+
+	broker.Unsubscribe(events)
+	var got []string
+	for ev := range events {
+		got = append(got, ev.Type+":"+ev.Task.Status)
+	}
+	want := "updated:pending deleted:pending updated:cancelled deleted:cancelled"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("events %v; want %s", got, want)
+	}
+}
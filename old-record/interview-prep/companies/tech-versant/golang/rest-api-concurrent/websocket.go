@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ─── WEBSOCKET (RFC 6455, stdlib only) ───
+//
+// Just enough of the protocol for a JSON command channel: the opening
+// handshake, text messages (fragmented or not), ping/pong and the close
+// handshake. Binary messages are refused with 1003.
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close codes used by this server.
+const (
+	closeNormal         = 1000
+	closeGoingAway      = 1001
+	closeProtocolError  = 1002
+	closeUnsupported    = 1003
+	closeInvalidPayload = 1007
+	closePolicy         = 1008
+	closeTooBig         = 1009
+	closeInternal       = 1011
+)
+
+const (
+	wsMaxMessage = 64 << 10
+	wsPongWait   = 60 * time.Second
+	wsPingEvery  = 25 * time.Second
+	wsWriteWait  = 10 * time.Second
+)
+
+// wsCloseError is returned by ReadMessage once the connection is closing.
+type wsCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	wmu       sync.Mutex // one frame at a time on the wire
+	closeOnce sync.Once
+	closeSent bool
+}
+
+// upgradeWebSocket performs the server side of the opening handshake. On
+// failure it has already written an HTTP error.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a websocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("not a websocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("bad websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "bad Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("bad websocket key")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket unsupported", http.StatusInternalServerError)
+		return nil, errors.New("response writer cannot hijack")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("hijack: %w", err)
+	}
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("handshake: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &wsConn{conn: conn, br: brw.Reader}, nil
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeFrame sends one unmasked, unfragmented frame.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return net.ErrClosed
+	}
+
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | op // FIN
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	if op == opClose {
+		c.closeSent = true
+	}
+	return nil
+}
+
+func (c *wsConn) WriteText(data []byte) error { return c.writeFrame(opText, data) }
+func (c *wsConn) Ping() error                 { return c.writeFrame(opPing, nil) }
+
+// Close sends a close frame (once) and tears down the TCP connection.
+func (c *wsConn) Close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+		payload = append(payload, reason...)
+		c.writeFrame(opClose, payload)
+		c.conn.Close()
+	})
+}
+
+type wsFrame struct {
+	fin     bool
+	op      byte
+	payload []byte
+}
+
+func (c *wsConn) readFrame() (wsFrame, error) {
+	var f wsFrame
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return f, err
+	}
+	f.fin = hdr[0]&0x80 != 0
+	f.op = hdr[0] & 0x0F
+	if hdr[0]&0x70 != 0 {
+		return f, &wsCloseError{closeProtocolError, "reserved bits set"}
+	}
+	if hdr[1]&0x80 == 0 {
+		return f, &wsCloseError{closeProtocolError, "client frames must be masked"}
+	}
+
+	n := uint64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return f, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return f, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if f.op >= opClose && (n > 125 || !f.fin) {
+		return f, &wsCloseError{closeProtocolError, "bad control frame"}
+	}
+	if n > wsMaxMessage {
+		return f, &wsCloseError{closeTooBig, "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return f, err
+	}
+	f.payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return f, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+// ReadMessage returns the next complete text message. Pings are answered
+// and pongs extend the read deadline along the way. A close frame from
+// the peer is echoed and reported as *wsCloseError; protocol violations
+// close the connection with the matching code.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var msg []byte
+	inMessage := false
+
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		f, err := c.readFrame()
+		if err != nil {
+			var ce *wsCloseError
+			if errors.As(err, &ce) {
+				c.Close(ce.Code, ce.Reason)
+			}
+			return nil, err
+		}
+
+		switch f.op {
+		case opPing:
+			if err := c.writeFrame(opPong, f.payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+			// read deadline already extended
+		case opClose:
+			code := closeNormal
+			if len(f.payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(f.payload))
+			}
+			c.Close(code, "")
+			return nil, &wsCloseError{Code: code, Reason: string(f.payload[min(2, len(f.payload)):])}
+		case opText, opContinuation:
+			if (f.op == opText) == inMessage {
+				c.Close(closeProtocolError, "unexpected continuation")
+				return nil, &wsCloseError{closeProtocolError, "unexpected continuation"}
+			}
+			inMessage = true
+			msg = append(msg, f.payload...)
+			if len(msg) > wsMaxMessage {
+				c.Close(closeTooBig, "message too big")
+				return nil, &wsCloseError{closeTooBig, "message too big"}
+			}
+			if f.fin {
+				if !utf8.Valid(msg) {
+					c.Close(closeInvalidPayload, "invalid utf-8")
+					return nil, &wsCloseError{closeInvalidPayload, "invalid utf-8"}
+				}
+				return msg, nil
+			}
+		case opBinary:
+			c.Close(closeUnsupported, "text frames only")
+			return nil, &wsCloseError{closeUnsupported, "text frames only"}
+		default:
+			c.Close(closeProtocolError, "unknown opcode")
+			return nil, &wsCloseError{closeProtocolError, "unknown opcode"}
+		}
+	}
+}
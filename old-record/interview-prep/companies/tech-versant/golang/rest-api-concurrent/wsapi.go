@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"taskkit/validate"
+)
+
+// ─── WEBSOCKET COMMAND API ───
+//
+// GET /api/ws upgrades to a WebSocket speaking JSON, one object per text
+// message; GET /api/projects/{pid}/ws is the same socket scoped to project
+// pid, so its commands and events only reach that project's tasks.
+// Client → server:
+//
+//	{"op":"create",      "ref":"1", "task":{"title":"x","type":"email",...}}
+//	{"op":"cancel",      "ref":"2", "id":"<task id>"}
+//	{"op":"get",         "ref":"3", "id":"<task id>"}
+//	{"op":"subscribe",   "ref":"4", "id":"<task id>"}   // omit id = all tasks
+//	{"op":"unsubscribe", "ref":"5", "id":"<task id>"}   // omit id = all
+//
+// Server → client: {"type":"ack","ref":..,"task":..} or
+// {"type":"error","ref":..,"status":409,"error":".."} per command, and
+// {"type":"event","event":{...}} for subscribed task changes. A create
+// takes a token from the caller's POST /api/tasks bucket and is refused
+// with status 429 when it is empty.
+//
+// Each connection has its own bounded send buffer drained by a writer
+// goroutine. If a client reads too slowly and the buffer fills, the
+// connection is closed (1008) — publishers never wait on a socket.
+
+const wsSendBuffer = 64
+
+type wsCommand struct {
+	Op   string          `json:"op"`
+	Ref  string          `json:"ref,omitempty"`
+	ID   string          `json:"id,omitempty"`
+	Task json.RawMessage `json:"task,omitempty"` // decoded like a POST /api/tasks body
+}
+
+type wsReply struct {
+	Type   string          `json:"type"` // "ack" | "error" | "event"
+	Ref    string          `json:"ref,omitempty"`
+	Task   *Task           `json:"task,omitempty"`
+	Event  *TaskEvent      `json:"event,omitempty"`
+	Status int             `json:"status,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Errors validate.Errors `json:"errors,omitempty"` // field errors of a rejected create
+}
+
+type wsSession struct {
+	ctx  context.Context // upgrade request's; carries its X-Request-ID
+	conn *wsConn
+	send chan []byte
+	done chan struct{}
+	stop sync.Once
+
+	mu   sync.Mutex
+	all  bool            // subscribed to every task
+	subs map[string]bool // subscribed task IDs
+}
+
+func serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+
+	s := &wsSession{
+		ctx:  r.Context(),
+		conn: conn,
+		send: make(chan []byte, wsSendBuffer),
+		done: make(chan struct{}),
+		subs: make(map[string]bool),
+	}
+	events, _, _ := broker.Subscribe(0)
+	defer broker.Unsubscribe(events)
+
+	go s.writeLoop()
+	go s.forward(events)
+
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			s.close(closeNormal, "")
+			return
+		}
+		s.handle(msg)
+	}
+}
+
+func (s *wsSession) close(code int, reason string) {
+	s.stop.Do(func() {
+		close(s.done)
+		s.conn.Close(code, reason)
+	})
+}
+
+// push queues a message without blocking; a full buffer drops the client.
+func (s *wsSession) push(v wsReply) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.close(closeInternal, "encoding failed")
+		return
+	}
+	select {
+	case s.send <- data:
+	case <-s.done:
+	default:
+		s.close(closePolicy, "too slow")
+	}
+}
+
+func (s *wsSession) writeLoop() {
+	ping := time.NewTicker(wsPingEvery)
+	defer ping.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case data := <-s.send:
+			if err := s.conn.WriteText(data); err != nil {
+				s.close(closeGoingAway, "")
+				return
+			}
+		case <-ping.C:
+			if err := s.conn.Ping(); err != nil {
+				s.close(closeGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+// forward relays broker events the client subscribed to.
+func (s *wsSession) forward(events chan TaskEvent) {
+	for {
+		select {
+		case <-s.done:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				// broker dropped us or the server is shutting down
+				s.close(closeGoingAway, "event stream ended")
+				return
+			}
+			if s.wants(ev.Task.ID) && canAccess(s.ctx, ev.Task) {
+				s.push(wsReply{Type: "event", Event: &ev})
+			}
+		}
+	}
+}
+
+func (s *wsSession) wants(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.all || s.subs[id]
+}
+
+// writable re-checks the session's project before a write: it may have
+// been archived or deleted since the upgrade, which inProject answered.
+func (s *wsSession) writable() (int, error) {
+	pid := projectFrom(s.ctx)
+	if pid == "" {
+		return 0, nil
+	}
+	p, ok := getVisibleProject(s.ctx, pid)
+	switch {
+	case !ok:
+		return http.StatusNotFound, errors.New("project not found")
+	case p.ArchivedAt != nil:
+		return http.StatusConflict, errors.New("project is archived")
+	}
+	return 0, nil
+}
+
+func (s *wsSession) handle(msg []byte) {
+	var cmd wsCommand
+	if err := json.Unmarshal(msg, &cmd); err != nil {
+		s.push(wsReply{Type: "error", Status: http.StatusBadRequest, Error: "invalid json"})
+		return
+	}
+	fail := func(status int, err error) {
+		reply := wsReply{Type: "error", Ref: cmd.Ref, Status: status, Error: err.Error()}
+		errors.As(err, &reply.Errors)
+		s.push(reply)
+	}
+	ack := func(t *Task) {
+		s.push(wsReply{Type: "ack", Ref: cmd.Ref, Task: t})
+	}
+
+	switch cmd.Op {
+	case "create":
+		if cmd.Task == nil {
+			fail(http.StatusBadRequest, errors.New("task is required"))
+			return
+		}
+		var t Task
+		if err := validate.WithRules(validate.Decode(cmd.Task, &t), func() error { return validateTask(&t, true) }); err != nil {
+			fail(http.StatusBadRequest, err)
+			return
+		}
+		if status, err := s.writable(); err != nil {
+			fail(status, err)
+			return
+		}
+		u, _ := UserFrom(s.ctx)
+		if res := allowCreate(u); !res.allowed {
+			fail(http.StatusTooManyRequests, fmt.Errorf("rate limit exceeded; retry after %ds", int(math.Ceil(res.retryAfter.Seconds()))))
+			return
+		}
+		t, status, err := submitTask(s.ctx, t)
+		if err != nil {
+			fail(status, err)
+			return
+		}
+		ack(&t)
+
+	case "cancel":
+		t, ok := getVisible(s.ctx, cmd.ID)
+		if !ok {
+			fail(http.StatusNotFound, ErrNotFound)
+			return
+		}
+		if status, err := s.writable(); err != nil {
+			fail(status, err)
+			return
+		}
+		t, err := cancelByID(s.ctx, t.key(), nil)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			fail(http.StatusNotFound, err)
+		case errors.Is(err, ErrInvalidTransition):
+			fail(http.StatusConflict, fmt.Errorf("task already %s", t.Status))
+		case errors.Is(err, ErrVersionConflict):
+			fail(http.StatusConflict, err)
+		case err != nil:
+			fail(http.StatusInternalServerError, errors.New("could not cancel task"))
+		default:
+			ack(&t)
+		}
+
+	case "get":
+		t, ok := getVisible(s.ctx, cmd.ID)
+		if !ok {
+			fail(http.StatusNotFound, ErrNotFound)
+			return
+		}
+		ack(&t)
+
+	case "subscribe":
+		s.mu.Lock()
+		if cmd.ID == "" {
+			s.all = true
+		} else {
+			s.subs[cmd.ID] = true
+		}
+		s.mu.Unlock()
+		ack(nil)
+
+	case "unsubscribe":
+		s.mu.Lock()
+		if cmd.ID == "" {
+			s.all = false
+			clear(s.subs)
+		} else {
+			delete(s.subs, cmd.ID)
+		}
+		s.mu.Unlock()
+		ack(nil)
+
+	default:
+		fail(http.StatusBadRequest, fmt.Errorf("unknown op %q", cmd.Op))
+	}
+}
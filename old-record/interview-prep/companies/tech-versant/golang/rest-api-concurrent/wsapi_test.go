@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"taskkit/validate"
+)
+
+// wsClient is the client half of the handshake and framing in
+// websocket.go: masked text frames out, unmasked frames in.
+type wsClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dialWS opens path on s as alice.
+func (s *server) dialWS(path string) *wsClient {
+	s.t.Helper()
+	srv := httptest.NewServer(s.handler)
+	s.t.Cleanup(srv.Close)
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() { conn.Close() })
+	req, _ := http.NewRequest("GET", srv.URL+path, nil)
+	req.Header.Set("X-API-Key", "alice-key")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if err := req.Write(conn); err != nil {
+		s.t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		s.t.Fatalf("GET %s: %d; want 101", path, resp.StatusCode)
+	}
+	return &wsClient{s.t, conn, br}
+}
+
+// call sends cmd and returns the reply to it, skipping events.
+func (c *wsClient) call(cmd wsCommand) wsReply {
+	c.t.Helper()
+	data, _ := json.Marshal(cmd)
+	c.send(data)
+	for {
+		reply := c.recv()
+		if reply.Type != "event" {
+			return reply
+		}
+	}
+}
+
+// callAndWait is call for a subscribed client: it also waits for the
+// event about the task in the reply, which may come before or after it,
+// and returns every event read on the way.
+func (c *wsClient) callAndWait(cmd wsCommand) (wsReply, []TaskEvent) {
+	c.t.Helper()
+	data, _ := json.Marshal(cmd)
+	c.send(data)
+	var reply wsReply
+	var events []TaskEvent
+	for reply.Type == "" || reply.Task != nil && !slices.ContainsFunc(events, func(ev TaskEvent) bool { return ev.Task.ID == reply.Task.ID }) {
+		got := c.recv()
+		if got.Type == "event" {
+			events = append(events, *got.Event)
+		} else {
+			reply = got
+		}
+	}
+	return reply, events
+}
+
+func (c *wsClient) send(data []byte) {
+	c.t.Helper()
+	frame := []byte{0x80 | opText, 0x80 | 126}
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(data)))
+	frame = append(frame, 0, 0, 0, 0) // a zero mask leaves the payload as is
+	if _, err := c.conn.Write(append(frame, data...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *wsClient) recv() wsReply {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	n := int(hdr[1] & 0x7F)
+	if n == 126 {
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	if hdr[0]&0x0F != opText {
+		c.t.Fatalf("got frame op %d (%q); want text", hdr[0]&0x0F, payload)
+	}
+	var reply wsReply
+	if err := json.Unmarshal(payload, &reply); err != nil {
+		c.t.Fatal(err)
+	}
+	return reply
+}
+
+func TestWebSocketIsScopedToProject(t *testing.T) {
+	s := newServer(t)
+	a, b := s.project("a"), s.project("b")
+	inA, inB := s.dialWS(a+"/ws"), s.dialWS(b+"/ws")
+
+	reply := inA.call(wsCommand{Op: "create", Ref: "1", Task: json.RawMessage(`{"title":"in a"}`)})
+	if reply.Type != "ack" || reply.Task.ProjectID != a[len("/api/projects/"):] {
+		t.Fatalf("create over %s/ws: %+v; want a task in a", a, reply)
+	}
+	id := reply.Task.ID
+	if reply := inA.call(wsCommand{Op: "get", ID: id}); reply.Type != "ack" {
+		t.Fatalf("get over %s/ws: %+v", a, reply)
+	}
+
+	def := s.dialWS("/api/ws")
+	for prefix, c := range map[string]*wsClient{b: inB, "/api": def} {
+		for _, op := range []string{"get", "cancel"} {
+			if reply := c.call(wsCommand{Op: op, ID: id}); reply.Status != http.StatusNotFound {
+				t.Errorf("%s over %s/ws: %+v; want 404", op, prefix, reply)
+			}
+		}
+		c.call(wsCommand{Op: "subscribe"})
+	}
+
+	// only a's socket hears about a's task
+	inA.call(wsCommand{Op: "subscribe", ID: id})
+	if reply, events := inA.callAndWait(wsCommand{Op: "cancel", ID: id}); reply.Type != "ack" || len(events) != 1 {
+		t.Fatalf("cancel over %s/ws: %+v, events %+v; want an ack and the cancel event", a, reply, events)
+	}
+	for prefix, c := range map[string]*wsClient{b: inB, "/api": def} {
+		// events reach a subscriber in order: any for a's task comes
+		// before the one for a task created here afterwards
+		reply, events := c.callAndWait(wsCommand{Op: "create", Task: json.RawMessage(`{"title":"here"}`)})
+		if reply.Type != "ack" || len(events) != 1 {
+			t.Errorf("subscriber on %s/ws: %+v, events %+v; want only its own task's", prefix, reply, events)
+		}
+	}
+
+	// the socket re-checks its project on writes
+	s.do("POST", a+"/archive", nil, nil)
+	if reply := inA.call(wsCommand{Op: "create", Task: json.RawMessage(`{"title":"late"}`)}); reply.Status != http.StatusConflict {
+		t.Fatalf("create over the socket of an archived project: %+v; want 409", reply)
+	}
+}
+
+// A create over the socket rejects what POST /api/tasks rejects, with the
+// same field errors.
+func TestWebSocketCreateIsStrict(t *testing.T) {
+	s := newServer(t)
+	c := s.dialWS("/api/ws")
+	for _, body := range []string{
+		`{"title":"x","bogus":1}`,
+		`{"title":"x","status":"completed"}`,
+		`{"title":7}`,
+	} {
+		reply := c.call(wsCommand{Op: "create", Task: json.RawMessage(body)})
+		req := httptest.NewRequest("POST", "/api/tasks", strings.NewReader(body))
+		req.Header.Set("X-API-Key", "alice-key")
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		var p validate.Problem
+		json.Unmarshal(rec.Body.Bytes(), &p)
+		if rec.Code != http.StatusBadRequest || reply.Status != http.StatusBadRequest {
+			t.Errorf("%s: POST → %d, socket → %+v; want 400 from both", body, rec.Code, reply)
+			continue
+		}
+		if got, want := reply.Error, cmp.Or(p.Detail, strings.TrimSpace(rec.Body.String())); got != want {
+			t.Errorf("%s: socket error %q; POST said %q", body, got, want)
+		}
+	}
+	if n := len(store.GetAll()); n != 0 {
+		t.Fatalf("%d tasks stored from rejected creates", n)
+	}
+}
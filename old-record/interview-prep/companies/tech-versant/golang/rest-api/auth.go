@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ─── AUTHENTICATION ───
+//
+// Every /api request must identify a user, either with
+//
+//	X-API-Key: <key>                   (long-lived, from the users file)
+//	Authorization: Bearer <token>      (short-lived, from POST /api/tokens)
+//
+// Bearer tokens are "<payload>.<signature>", both base64url: the payload
+// is {"sub":<user id>,"exp":<unix seconds>} and the signature is its
+// HMAC-SHA256 under -token-secret. The user is looked up again on every
+// request, so removing someone from the users file revokes their tokens.
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin" // sees and edits every task
+)
+
+type User struct {
+	ID     string `json:"id"`
+	Role   string `json:"role"`
+	APIKey string `json:"apiKey"`
+}
+
+var (
+	usersPath   = flag.String("users", "", `users file: JSON [{"id","role","apiKey"}] (empty = demo users)`)
+	tokenSecret = flag.String("token-secret", os.Getenv("TOKEN_SECRET"), "HMAC key for bearer tokens (default $TOKEN_SECRET, else random per run)")
+	tokenTTL    = flag.Duration("token-ttl", time.Hour, "lifetime of tokens issued by POST /api/tokens")
+)
+
+// demoUsers is used when no -users file is given.
+var demoUsers = []User{
+	{ID: "alice", Role: RoleUser, APIKey: "alice-key"},
+	{ID: "bob", Role: RoleUser, APIKey: "bob-key"},
+	{ID: "admin", Role: RoleAdmin, APIKey: "admin-key"},
+}
+
+// userDirectory indexes users by ID and by the SHA-256 of their API key,
+// so a lookup never compares raw keys.
+type userDirectory struct {
+	byID  map[string]User
+	byKey map[[sha256.Size]byte]User
+}
+
+var (
+	users     *userDirectory
+	signKey   []byte
+	errNoAuth = errors.New("missing credentials")
+)
+
+// setupAuth loads the users and the token signing key.
+func setupAuth(path, secret string) error {
+	list := demoUsers
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading users: %w", err)
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("parsing users: %w", err)
+		}
+	} else {
+		slog.Warn("no -users file: using demo API keys alice-key, bob-key, admin-key")
+	}
+
+	d := &userDirectory{byID: make(map[string]User), byKey: make(map[[sha256.Size]byte]User)}
+	for _, u := range list {
+		if u.ID == "" || u.APIKey == "" {
+			return errors.New("users: id and apiKey are required")
+		}
+		if u.Role != RoleUser && u.Role != RoleAdmin {
+			return fmt.Errorf("users: %s has unknown role %q", u.ID, u.Role)
+		}
+		if _, dup := d.byID[u.ID]; dup {
+			return fmt.Errorf("users: duplicate id %s", u.ID)
+		}
+		d.byID[u.ID] = u
+		d.byKey[sha256.Sum256([]byte(u.APIKey))] = u
+	}
+	users = d
+
+	if secret != "" {
+		signKey = []byte(secret)
+	} else {
+		signKey = make([]byte, 32)
+		rand.Read(signKey)
+		slog.Warn("no -token-secret: bearer tokens will not survive a restart")
+	}
+	return nil
+}
+
+// ─── TOKENS ───
+
+type tokenClaims struct {
+	Sub string `json:"sub"`
+	Exp int64  `json:"exp"`
+}
+
+var b64 = base64.RawURLEncoding
+
+func signToken(userID string, exp time.Time) string {
+	payload, _ := json.Marshal(tokenClaims{Sub: userID, Exp: exp.Unix()})
+	p := b64.EncodeToString(payload)
+	return p + "." + b64.EncodeToString(tokenMAC(p))
+}
+
+func tokenMAC(payload string) []byte {
+	m := hmac.New(sha256.New, signKey)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
+
+func verifyToken(tok string, now time.Time) (User, error) {
+	p, sig, ok := strings.Cut(tok, ".")
+	if !ok {
+		return User{}, errors.New("malformed token")
+	}
+	got, err := b64.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, tokenMAC(p)) {
+		return User{}, errors.New("bad token signature")
+	}
+	payload, err := b64.DecodeString(p)
+	if err != nil {
+		return User{}, errors.New("malformed token")
+	}
+	var c tokenClaims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return User{}, errors.New("malformed token")
+	}
+	if now.Unix() >= c.Exp {
+		return User{}, errors.New("token expired")
+	}
+	u, ok := users.byID[c.Sub]
+	if !ok {
+		return User{}, errors.New("unknown user")
+	}
+	return u, nil
+}
+
+type tokenResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"tokenType"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// issueToken is POST /api/tokens: trade the caller's credentials for a
+// fresh bearer token.
+func issueToken(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-API-Key") == "" {
+		writeError(w, http.StatusForbidden, "tokens are only issued for API keys")
+		return
+	}
+	u, _ := UserFrom(r.Context())
+	exp := time.Now().Add(*tokenTTL)
+	writeJSON(w, http.StatusCreated, tokenResponse{
+		Token:     signToken(u.ID, exp),
+		TokenType: "Bearer",
+		ExpiresAt: exp.UTC().Truncate(time.Second),
+	})
+}
+
+// ─── MIDDLEWARE ───
+
+// credentials resolves the request's API key or bearer token.
+func credentials(r *http.Request) (User, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		u, ok := users.byKey[sha256.Sum256([]byte(key))]
+		if !ok {
+			return User{}, errors.New("unknown API key")
+		}
+		return u, nil
+	}
+	scheme, tok, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if tok != "" && strings.EqualFold(scheme, "Bearer") {
+		return verifyToken(strings.TrimSpace(tok), time.Now())
+	}
+	return User{}, errNoAuth
+}
+
+// authenticate rejects /api requests without valid credentials and puts
+// the user in the context. Everything else (/metrics) stays public.
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		u, err := credentials(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tasks"`)
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, u)))
+	})
+}
+
+// UserFrom returns the user stored by the authenticate middleware.
+func UserFrom(ctx context.Context) (User, bool) {
+	u, ok := ctx.Value(userKey).(User)
+	return u, ok
+}
+
+// ─── OWNERSHIP ───
+
+// canAccess reports whether the caller may see t: admins see every task,
+// users only their own.
+func canAccess(ctx context.Context, t Task) bool {
+	u, ok := UserFrom(ctx)
+	return ok && (u.Role == RoleAdmin || t.OwnerID == u.ID)
+}
+
+// visibleTasks filters tasks down to those the caller may see.
+func visibleTasks(ctx context.Context, tasks []Task) []Task {
+	out := tasks[:0]
+	for _, t := range tasks {
+		if canAccess(ctx, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// getVisible is store.Get that hides other users' tasks. Callers answer
+// 404 either way, so IDs of foreign tasks are not disclosed.
+func getVisible(ctx context.Context, id string) (Task, bool) {
+	t, ok := store.Get(id)
+	if !ok || !canAccess(ctx, t) {
+		return Task{}, false
+	}
+	return t, true
+}
@@ -1,3 +1,7 @@
 module rest-api
 
 go 1.25.6
+
+require taskkit v0.0.0
+
+replace taskkit => ../taskkit
@@ -85,32 +85,420 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
 	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"taskkit/etag"
+	"taskkit/idempotency"
+	"taskkit/ids"
+	"taskkit/validate"
 )
 
+// ─── MODEL ───
+
 type Task struct {
-	ID    string `json:"id"`
-	Title string `json:"title"`
-	Done  bool   `json:"done"`
+	ID        string     `json:"id" validate:"readonly"`
+	Title     string     `json:"title" validate:"required,max=200"`
+	Done      bool       `json:"done"`
+	Tags      []string   `json:"tags,omitempty" validate:"max=20,tags"` // indexed, see GET /api/tasks?tag=
+	DueAt     *time.Time `json:"dueAt,omitempty"`                       // deadline, see reminders.go
+	OwnerID   string     `json:"ownerId" validate:"readonly"`           // set from the caller on create
+	CreatedAt time.Time  `json:"createdAt" validate:"readonly"`         // set by the store on first write
+	UpdatedAt time.Time  `json:"updatedAt" validate:"readonly"`         // set by the store on every write
+	Version   int64      `json:"version" validate:"readonly"`           // bumped by the store on every write
+}
+
+// open reports whether t still needs doing; only open tasks are overdue
+// or get reminders.
+func (t Task) open() bool { return !t.Done }
+
+// ─── STORE ───
+
+var store TaskRepository
+
+// seed fills an empty in-memory store with the demo tasks.
+func seed(repo TaskRepository) {
+	now := time.Now()
+	repo.Set(Task{ID: "1", Title: "Task1", Done: true, OwnerID: "alice", CreatedAt: now})
+	due := now.Add(10 * time.Minute)
+	repo.Set(Task{ID: "2", Title: "Task2", Done: false, Tags: []string{"demo"}, DueAt: &due, OwnerID: "alice", CreatedAt: now})
 }
 
-var task = []Task{
-	{ID: "1", Title: "Task1", Done: true},
-	{ID: "2", Title: "Task2", Done: false},
+// ─── JSON HELPERS ───
+
+type errorBody struct {
+	Error string `json:"error"`
 }
 
-func getTasks(w http.ResponseWriter, r *http.Request) {
+func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(task)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorBody{Error: msg})
+}
+
+// writeSaveError answers a failed CompareAndSwap: 412 when the client
+// sent If-Match, 409 when the race was between two unconditional writes.
+func writeSaveError(w http.ResponseWriter, r *http.Request, id string, err error) {
+	if errors.Is(err, ErrVersionConflict) {
+		status := http.StatusConflict
+		if r.Header.Get("If-Match") != "" {
+			status = http.StatusPreconditionFailed
+		}
+		writeError(w, status, "task was modified concurrently; fetch it and retry")
+		return
+	}
+	logFrom(r.Context()).Error("saving task", "task_id", id, "err", err)
+	writeError(w, http.StatusInternalServerError, "could not save task")
+}
+
+// ─── HANDLERS ───
+
+func getTasks(w http.ResponseWriter, r *http.Request) {
+	q, err := parseTaskQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, next := q.apply(visibleTasks(r.Context(), q.candidates(store)))
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+		w.Header().Set("Link", "<"+nextLink(r.URL, next)+`>; rel="next"`)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func getTaskByID(w http.ResponseWriter, r *http.Request) {
+	t, ok := getVisible(r.Context(), r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "task not found")
+		return
+	}
+	w.Header().Set("ETag", etag.Of(t.Version))
+	if etag.NotModified(r, t.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func createTask(w http.ResponseWriter, r *http.Request) {
+	var t Task
+	err := validate.WithRules(validate.DecodeJSON(w, r, &t), func() error {
+		t.Tags = validate.NormalizeTags(t.Tags)
+		return validate.Struct(&t, true).Err()
+	})
+	if err != nil {
+		validate.WriteDecodeError(w, err)
+		return
+	}
+	t.ID = ids.New()
+	u, _ := UserFrom(r.Context())
+	t.OwnerID = u.ID
+
+	t, err = store.CompareAndSwap(t, 0)
+	if err != nil {
+		writeSaveError(w, r, t.ID, err)
+		return
+	}
+	w.Header().Set("ETag", etag.Of(t.Version))
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// replaceTask is PUT: the body is the full new representation.
+// An "id" in the body must match the path, otherwise 409. ownerId and the
+// timestamps are server-maintained and always kept from the stored task.
+// If-Match is honoured (412); see taskkit/etag.
+func replaceTask(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var t Task
+	err := validate.WithRules(validate.DecodeJSON(w, r, &t), func() error {
+		t.Tags = validate.NormalizeTags(t.Tags)
+		return validate.Struct(&t, false).Err()
+	})
+	if err != nil {
+		validate.WriteDecodeError(w, err)
+		return
+	}
+	if t.ID != "" && t.ID != id {
+		writeError(w, http.StatusConflict, "id in body does not match path")
+		return
+	}
+	t.ID = id
+
+	old, ok := getVisible(r.Context(), id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "task not found")
+		return
+	}
+	if !etag.IfMatch(r, old.Version) {
+		writeError(w, http.StatusPreconditionFailed, "If-Match does not match the current ETag "+etag.Of(old.Version))
+		return
+	}
+	t.OwnerID = old.OwnerID
+	t, err = store.CompareAndSwap(t, old.Version)
+	if err != nil {
+		writeSaveError(w, r, id, err)
+		return
+	}
+	w.Header().Set("ETag", etag.Of(t.Version))
+	writeJSON(w, http.StatusOK, t)
+}
+
+// patchTask is PATCH with JSON Merge Patch (RFC 7396) semantics:
+// present keys overwrite, null resets the field to its zero value,
+// absent keys are left untouched.
+func patchTask(w http.ResponseWriter, r *http.Request) {
+	ct := r.Header.Get("Content-Type")
+	if ct != "" && !strings.HasPrefix(ct, "application/merge-patch+json") && !strings.HasPrefix(ct, "application/json") {
+		writeError(w, http.StatusUnsupportedMediaType, "use application/merge-patch+json")
+		return
+	}
+
+	id := r.PathValue("id")
+	var patch map[string]json.RawMessage
+	if err := validate.DecodeJSON(w, r, &patch); err != nil {
+		validate.WriteDecodeError(w, err)
+		return
+	}
+
+	t, ok := getVisible(r.Context(), id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "task not found")
+		return
+	}
+	if !etag.IfMatch(r, t.Version) {
+		writeError(w, http.StatusPreconditionFailed, "If-Match does not match the current ETag "+etag.Of(t.Version))
+		return
+	}
+	version := t.Version
+
+	var errs validate.Errors
+	for _, key := range slices.Sorted(maps.Keys(patch)) {
+		raw := patch[key]
+		isNull := string(raw) == "null"
+		switch key {
+		case "id":
+			var pid string
+			if !isNull {
+				json.Unmarshal(raw, &pid)
+			}
+			if pid != id {
+				writeError(w, http.StatusConflict, "id cannot be changed")
+				return
+			}
+		case "title":
+			t.Title = ""
+			if !isNull && json.Unmarshal(raw, &t.Title) != nil {
+				errs.Add(key, "must be a string")
+			}
+		case "done":
+			t.Done = false
+			if !isNull && json.Unmarshal(raw, &t.Done) != nil {
+				errs.Add(key, "must be a boolean")
+			}
+		case "tags":
+			t.Tags = nil
+			if !isNull && json.Unmarshal(raw, &t.Tags) != nil {
+				errs.Add(key, "must be an array")
+			}
+			t.Tags = validate.NormalizeTags(t.Tags)
+		case "dueAt":
+			t.DueAt = nil
+			if !isNull && json.Unmarshal(raw, &t.DueAt) != nil {
+				errs.Add(key, "must be an RFC 3339 timestamp")
+			}
+		case "ownerId", "createdAt", "updatedAt", "version":
+			// server-maintained, ignored like in PUT
+		default:
+			errs.Add(key, "unknown field")
+		}
+	}
+	if err := validate.WithRules(errs.Err(), func() error { return validate.Struct(&t, false).Err() }); err != nil {
+		validate.WriteDecodeError(w, err)
+		return
+	}
+
+	t, err := store.CompareAndSwap(t, version)
+	if err != nil {
+		writeSaveError(w, r, id, err)
+		return
+	}
+	w.Header().Set("ETag", etag.Of(t.Version))
+	writeJSON(w, http.StatusOK, t)
+}
+
+func deleteTask(w http.ResponseWriter, r *http.Request) {
+	if _, ok := getVisible(r.Context(), r.PathValue("id")); !ok {
+		writeError(w, http.StatusNotFound, "task not found")
+		return
+	}
+	err := store.Delete(r.PathValue("id"))
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, "task not found")
+		return
+	}
+	if err != nil {
+		logFrom(r.Context()).Error("deleting task", "task_id", r.PathValue("id"), "err", err)
+		writeError(w, http.StatusInternalServerError, "could not delete task")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
+// ─── MAIN ───
+
 func main() {
+	flag.Parse()
+	if err := setupLogging(*logFormat, *logLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if err := setupAuth(*usersPath, *tokenSecret); err != nil {
+		slog.Error("loading users", "err", err)
+		os.Exit(1)
+	}
+	limiter, err := newRateLimiter(*rateLimits)
+	if err != nil {
+		slog.Error("rate limits", "err", err)
+		os.Exit(1)
+	}
+	if limiter != nil {
+		go limiter.evictLoop(context.Background(), time.Minute)
+	}
+	go idempotency.EvictLoop(context.Background(), time.Minute)
+
+	store, err = openRepository(*storeKind, *storePath)
+	if err != nil {
+		slog.Error("opening store", "err", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	if *storeKind == "memory" {
+		seed(store)
+	}
+	if *remindBefore > 0 {
+		go remindLoop(context.Background(), store, *remindBefore, *remindEvery, func(t Task) {
+			slog.Info("task due soon", "task_id", t.ID, "owner", t.OwnerID, "due_at", t.DueAt)
+		})
+	}
 
 	mux := http.NewServeMux()
+	routes(newAPI(mux))
+
+	slog.Info("server on :8080", "store", *storeKind)
+	if err := http.ListenAndServe(":8080", chain(mux, requestID, accessLog, instrument(mux), rateLimit(limiter, mux), authenticate)); err != nil {
+		slog.Error("server stopped", "err", err)
+	}
 
-	mux.HandleFunc("GET /api/tasks", getTasks)
+}
 
-	http.ListenAndServe(":8080", mux)
+// idempotent makes a POST handler honour Idempotency-Key, keyed per user.
+var idempotent = idempotency.Middleware(func(r *http.Request) string {
+	u, _ := UserFrom(r.Context())
+	return u.ID
+})
 
+// routes registers every handler on api; openapi_test.go builds the
+// same mux.
+func routes(api *api) {
+
+	api.handle("GET /api/tasks", http.HandlerFunc(getTasks), op{
+		ID: "getTasks", Summary: "List the caller's tasks",
+		Params: []param{
+			queryParam("done", "only tasks with this done flag", schema{"type": "boolean"}),
+			queryParam("tag", "only tasks carrying this tag", schema{"type": "string"}),
+			queryParam("overdue", "only tasks that are (or are not) open past dueAt", schema{"type": "boolean"}),
+			queryParam("q", "case-insensitive title search", schema{"type": "string"}),
+			queryParam("sort", "sort key, - for descending", schema{"type": "string", "enum": []string{"createdAt", "-createdAt", "title", "-title"}}),
+			queryParam("limit", "page size (default: everything)", schema{"type": "integer", "minimum": 1, "maximum": maxPageSize}),
+			queryParam("next", "X-Next-Cursor of the previous page", schema{"type": "string"}),
+		},
+		Responses: map[int]any{200: []Task{}, 400: errorBody{}},
+	})
+	api.handle("GET /api/tasks/{id}", http.HandlerFunc(getTaskByID), op{
+		ID: "getTaskByID", Summary: "Get one task; its ETag is the task version",
+		Params:    []param{headerParam("If-None-Match", "ETag from an earlier GET")},
+		Responses: map[int]any{200: Task{}, 304: nil, 404: errorBody{}},
+	})
+	api.handle("POST /api/tasks", idempotent(http.HandlerFunc(createTask)), op{
+		ID: "createTask", Summary: "Create a task owned by the caller",
+		Params:    []param{headerParam("Idempotency-Key", "retry-safe key; the first response is replayed")},
+		Body:      Task{},
+		Example:   map[string]any{"title": "New task"},
+		Responses: map[int]any{201: Task{}, 400: validate.Problem{}, 409: validate.Problem{}, 413: validate.Problem{}, 422: validate.Problem{}},
+	})
+	api.handle("PUT /api/tasks/{id}", http.HandlerFunc(replaceTask), op{
+		ID: "replaceTask", Summary: "Replace a task",
+		Params:    []param{headerParam("If-Match", "ETag the update is based on")},
+		Body:      Task{},
+		Example:   map[string]any{"title": "Renamed", "done": false},
+		Responses: map[int]any{200: Task{}, 400: validate.Problem{}, 404: errorBody{}, 409: errorBody{}, 412: errorBody{}, 413: validate.Problem{}},
+	})
+	api.handle("PATCH /api/tasks/{id}", http.HandlerFunc(patchTask), op{
+		ID: "patchTask", Summary: "Update some fields of a task (JSON Merge Patch)",
+		Params:    []param{headerParam("If-Match", "ETag the update is based on")},
+		Body:      Task{},
+		BodyMedia: "application/merge-patch+json",
+		Example:   map[string]any{"done": true},
+		Responses: map[int]any{200: Task{}, 400: validate.Problem{}, 404: errorBody{}, 409: errorBody{}, 412: errorBody{},
+			413: validate.Problem{}, 415: errorBody{}},
+	})
+	api.handle("DELETE /api/tasks/{id}", http.HandlerFunc(deleteTask), op{
+		ID: "deleteTask", Summary: "Delete a task",
+		Responses: map[int]any{204: nil, 404: errorBody{}},
+	})
+	api.handle("POST /api/tokens", http.HandlerFunc(issueToken), op{
+		ID: "issueToken", Summary: "Trade an API key for a short-lived bearer token",
+		Responses: map[int]any{201: tokenResponse{}, 403: errorBody{}},
+	})
+	api.handle("GET /metrics", registry, op{
+		ID: "metrics", Summary: "Prometheus metrics",
+		Responses: map[int]any{200: mediaType("text/plain")},
+	})
+	api.handle("GET /openapi.json", api, op{
+		ID: "openapi", Summary: "This document",
+		Responses: map[int]any{200: mediaType("application/json")},
+	})
 }
+
+// ─── TEST WITH ───
+// go run .                       (in-memory, seeded with 2 tasks)
+// go run . -store=json -data=tasks.json
+// go run . -store=log -data=tasks.log
+// go run . -log-format=json -log-level=debug
+// go run . -users=users.json -token-secret=change-me
+// go run . -rate-limits="POST /api/tasks=3:0.5"   (see 429s sooner)
+// Every /api call needs credentials; the examples assume
+//   alias curl="curl -H 'X-API-Key: alice-key'"   (demo keys: alice-key, bob-key, admin-key)
+// curl -X POST http://localhost:8080/api/tokens   → then -H 'Authorization: Bearer <token>'
+// curl http://localhost:8080/api/tasks
+// curl http://localhost:8080/api/tasks/1
+// curl 'http://localhost:8080/api/tasks?done=false&q=task&sort=-createdAt&limit=1'
+// curl 'http://localhost:8080/api/tasks?tag=demo&overdue=false'
+// curl -X POST http://localhost:8080/api/tasks -d '{"title":"Ship it","tags":["release"],"dueAt":"2030-01-01T09:00:00Z"}'
+// go run . -remind-before=1h     (logs "task due soon" for seeded task 2)
+// curl -X POST http://localhost:8080/api/tasks -d '{"title":"New task","done":false}'
+// curl -X POST http://localhost:8080/api/tasks -d '{"title":"","ownerId":"bob","extra":1}'   (400 problem+json, all 3 errors)
+// curl -X POST http://localhost:8080/api/tasks -H 'Idempotency-Key: abc' -d '{"title":"Once"}'   (repeat → same task, Idempotent-Replayed: true)
+// curl -X PUT http://localhost:8080/api/tasks/1 -d '{"title":"Renamed","done":false}'
+// curl -X PATCH http://localhost:8080/api/tasks/2 -H 'Content-Type: application/merge-patch+json' -d '{"done":true}'
+// curl -i http://localhost:8080/api/tasks/2 -H 'If-None-Match: "2"'   (304 while unchanged)
+// curl -X PUT http://localhost:8080/api/tasks/2 -H 'If-Match: "1"' -d '{"title":"Stale"}'   (412: ETag is now "2")
+// curl -X DELETE http://localhost:8080/api/tasks/1
+// curl http://localhost:8080/metrics
+// curl http://localhost:8080/openapi.json        (OpenAPI 3.1, generated from the routes in main)
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ─── METRICS REGISTRY ───
+//
+// A small dependency-free registry rendering the Prometheus text
+// exposition format (version 0.0.4). Each metric is a family of series
+// keyed by label values, given in the order the labels were declared:
+//
+//	httpRequests.Inc("GET", "/api/tasks", "200")
+
+type metricFamily interface {
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mu       sync.Mutex
+	families []metricFamily
+	names    map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, f metricFamily) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.families = append(r.families, f)
+}
+
+// ServeHTTP renders every registered metric.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	bw.Flush()
+}
+
+// vec holds the series of one labelled family.
+type vec[S any] struct {
+	name, help, kind string
+	labels           []string
+	newSeries        func() *S
+
+	mu     sync.Mutex
+	series map[string]*S
+	values map[string][]string // key → label values, for rendering
+}
+
+func newVec[S any](name, help, kind string, labels []string, newSeries func() *S) *vec[S] {
+	return &vec[S]{
+		name: name, help: help, kind: kind, labels: labels, newSeries: newSeries,
+		series: make(map[string]*S),
+		values: make(map[string][]string),
+	}
+}
+
+// with returns the series for the label values; the caller holds v.mu.
+func (v *vec[S]) with(values []string) *S {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = v.newSeries()
+		v.series[key] = s
+		v.values[key] = slices.Clone(values)
+	}
+	return s
+}
+
+// each calls fn for every series in a stable order; the caller holds v.mu.
+func (v *vec[S]) each(fn func(values []string, s *S)) {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fn(v.values[k], v.series[k])
+	}
+}
+
+func (v *vec[S]) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+}
+
+// ─── COUNTER / GAUGE ───
+
+type Counter struct{ v *vec[float64] }
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newVec(name, help, "counter", labels, func() *float64 { return new(float64) })}
+	r.register(name, c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+// Add increases the counter; negative deltas are ignored.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.v.mu.Lock()
+	*c.v.with(labelValues) += delta
+	c.v.mu.Unlock()
+}
+
+func (c *Counter) write(w *bufio.Writer) { writeScalars(w, c.v) }
+
+type Gauge struct{ v *vec[float64] }
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newVec(name, help, "gauge", labels, func() *float64 { return new(float64) })}
+	r.register(name, g)
+	return g
+}
+
+func (g *Gauge) Set(val float64, labelValues ...string) {
+	g.v.mu.Lock()
+	*g.v.with(labelValues) = val
+	g.v.mu.Unlock()
+}
+
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.v.mu.Lock()
+	*g.v.with(labelValues) += delta
+	g.v.mu.Unlock()
+}
+
+func (g *Gauge) write(w *bufio.Writer) { writeScalars(w, g.v) }
+
+func writeScalars(w *bufio.Writer, v *vec[float64]) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.header(w)
+	v.each(func(values []string, val *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, values), formatFloat(*val))
+	})
+}
+
+// gaugeFunc is an unlabelled gauge sampled at scrape time.
+type gaugeFunc struct {
+	name, help string
+	fn         func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &gaugeFunc{name, help, fn})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n",
+		g.name, escapeHelp(g.help), g.name, g.name, formatFloat(g.fn()))
+}
+
+// ─── HISTOGRAM ───
+
+// defBuckets suit request and job latencies in seconds.
+var defBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+type histSeries struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+type Histogram struct {
+	v       *vec[histSeries]
+	buckets []float64
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !slices.IsSorted(buckets) {
+		panic("metrics: " + name + " buckets not sorted")
+	}
+	h := &Histogram{buckets: buckets}
+	h.v = newVec(name, help, "histogram", labels, func() *histSeries {
+		return &histSeries{counts: make([]uint64, len(buckets))}
+	})
+	r.register(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(val float64, labelValues ...string) {
+	i, _ := slices.BinarySearch(h.buckets, val) // first bucket with le >= val
+	h.v.mu.Lock()
+	s := h.v.with(labelValues)
+	if i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.sum += val
+	s.count++
+	h.v.mu.Unlock()
+}
+
+// ObserveSince records the seconds elapsed since start.
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	v := h.v
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.header(w)
+	names := append(slices.Clone(v.labels), "le")
+	v.each(func(values []string, s *histSeries) {
+		labels := formatLabels(v.labels, values)
+		values = slices.Clip(values) // appending "le" must not touch the stored slice
+		var cum uint64
+		for i, le := range h.buckets {
+			cum += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(names, append(values, formatFloat(le))), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(names, append(values, "+Inf")), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, labels, s.count)
+	})
+}
+
+// ─── FORMATTING ───
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// ─── HTTP METRICS ───
+
+var (
+	registry = NewRegistry()
+
+	httpRequests = registry.NewCounter("http_requests_total",
+		"HTTP requests by method, route pattern and status code.", "method", "route", "code")
+	httpDuration = registry.NewHistogram("http_request_duration_seconds",
+		"HTTP request latency by method and route pattern.", defBuckets, "method", "route")
+	httpInFlight = registry.NewGauge("http_requests_in_flight",
+		"HTTP requests currently being served.")
+)
+
+func init() {
+	registry.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.",
+		func() float64 { return float64(runtime.NumGoroutine()) })
+}
+
+// instrument records per-route latency and status. The route is the
+// pattern mux would match, looked up up front so requests rejected by
+// middleware further in (401, 429) are still labelled by route.
+func instrument(mux *http.ServeMux) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			httpInFlight.Add(1)
+			defer httpInFlight.Add(-1)
+
+			// Label by pattern, never the raw path, to keep IDs out of series.
+			route := "unmatched"
+			if _, pattern := mux.Handler(r); pattern != "" {
+				route = pattern
+				if _, path, ok := strings.Cut(route, " "); ok {
+					route = path // method is its own label
+				}
+			}
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			httpRequests.Inc(r.Method, route, strconv.Itoa(rec.status))
+			httpDuration.ObserveSince(start, r.Method, route)
+		})
+	}
+}
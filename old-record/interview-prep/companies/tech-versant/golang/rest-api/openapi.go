@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"taskkit/validate"
+)
+
+// ─── OPENAPI 3.1 ───
+//
+// Routes are registered through an api, which hands them to the mux and
+// keeps their docs. GET /openapi.json is built from that list and from the
+// json/validate tags of the Go types each route names, so the document
+// can't drift from the handlers or the validation rules:
+//
+//	json:"title"                → property "title"
+//	validate:"required"         → listed in "required"
+//	validate:"max=200"          → maxLength / maximum / maxItems
+//	validate:"readonly"         → readOnly: true
+//	validate:"oneof=a|b"        → enum
+//	validate:"tags"             → items pattern
+//
+// openapi_test.go serves every route through httptest and fails when an
+// answer departs from the document; test.ps1 repeats the walk against a
+// running server.
+
+// op documents one route.
+type op struct {
+	ID        string // operationId, by convention the handler's name
+	Summary   string
+	Params    []param     // query and header parameters; path ones come from the pattern
+	Body      any         // request body sample: only its type is used
+	BodyMedia string      // default application/json
+	Example   any         // request body example, also what the contract tests send
+	Responses map[int]any // status → body sample (nil = no body, mediaType = not JSON)
+}
+
+type param struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Schema      schema `json:"schema"`
+}
+
+func queryParam(name, desc string, s schema) param {
+	return param{Name: name, In: "query", Description: desc, Schema: s}
+}
+
+func headerParam(name, desc string) param {
+	return param{Name: name, In: "header", Description: desc, Schema: schema{"type": "string"}}
+}
+
+// mediaType is a response body that isn't described by a Go type.
+type mediaType string
+
+type schema map[string]any
+
+type apiRoute struct {
+	method, path string
+	op           op
+}
+
+type api struct {
+	mux    *http.ServeMux
+	routes []apiRoute
+	doc    func() []byte
+}
+
+func newAPI(mux *http.ServeMux) *api {
+	a := &api{mux: mux}
+	a.doc = sync.OnceValue(func() []byte {
+		data, _ := json.MarshalIndent(a.spec(), "", "  ")
+		return data
+	})
+	return a
+}
+
+// handle registers h on the mux and documents it under pattern
+// ("METHOD /path").
+func (a *api) handle(pattern string, h http.Handler, o op) {
+	a.mux.Handle(pattern, h)
+	method, path, _ := strings.Cut(pattern, " ")
+	a.routes = append(a.routes, apiRoute{method: strings.ToLower(method), path: path, op: o})
+}
+
+// ServeHTTP is GET /openapi.json. The document is built on first request,
+// after every route is registered.
+func (a *api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(a.doc())
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+func (a *api) spec() schema {
+	g := &schemaGen{components: schema{}}
+	paths := schema{}
+	for _, rt := range a.routes {
+		item, _ := paths[rt.path].(schema)
+		if item == nil {
+			item = schema{}
+			paths[rt.path] = item
+		}
+		item[rt.method] = g.operation(rt)
+	}
+	return schema{
+		"openapi": "3.1.0",
+		"info": schema{
+			"title":   "Tasks API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": schema{
+			"schemas": g.components,
+			"securitySchemes": schema{
+				"apiKey": schema{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer": schema{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+func (g *schemaGen) operation(rt apiRoute) schema {
+	o := rt.op
+	params := []param{}
+	for _, m := range pathParam.FindAllStringSubmatch(rt.path, -1) {
+		params = append(params, param{Name: m[1], In: "path", Schema: schema{"type": "string"}})
+	}
+	params = append(params, o.Params...)
+
+	out := schema{
+		"operationId": o.ID,
+		"summary":     o.Summary,
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+	if strings.HasPrefix(rt.path, "/api/") {
+		out["security"] = []schema{{"apiKey": []string{}}, {"bearer": []string{}}}
+	} else {
+		out["security"] = []schema{} // public
+	}
+
+	if o.Body != nil {
+		media := o.BodyMedia
+		if media == "" {
+			media = "application/json"
+		}
+		s := g.schema(reflect.TypeOf(o.Body))
+		if media == "application/merge-patch+json" {
+			// every field optional: absent keys are left alone
+			s = g.object(reflect.TypeOf(o.Body), false)
+		}
+		content := schema{"schema": s}
+		if o.Example != nil {
+			content["example"] = o.Example
+		}
+		out["requestBody"] = schema{"required": true, "content": schema{media: content}}
+	}
+
+	responses := schema{}
+	for status, body := range o.Responses {
+		resp := schema{"description": http.StatusText(status)}
+		switch b := body.(type) {
+		case nil:
+		case mediaType:
+			resp["content"] = schema{string(b): schema{}}
+		default:
+			media := "application/json"
+			if reflect.TypeOf(b) == reflect.TypeFor[validate.Problem]() {
+				media = "application/problem+json"
+			}
+			resp["content"] = schema{media: schema{"schema": g.schema(reflect.TypeOf(b))}}
+		}
+		responses[strconv.Itoa(status)] = resp
+	}
+	if strings.HasPrefix(rt.path, "/api/") {
+		// every /api route can be refused by authenticate and rateLimit
+		for _, status := range []int{http.StatusUnauthorized, http.StatusTooManyRequests} {
+			responses[strconv.Itoa(status)] = schema{
+				"description": http.StatusText(status),
+				"content":     schema{"application/json": schema{"schema": g.schema(reflect.TypeFor[errorBody]())}},
+			}
+		}
+	}
+	out["responses"] = responses
+	return out
+}
+
+// ─── JSON SCHEMA FROM GO TYPES ───
+
+// schemaGen turns Go types into JSON Schema. Named structs become
+// components and are referenced with $ref.
+type schemaGen struct {
+	components schema
+}
+
+func (g *schemaGen) schema(t reflect.Type) schema {
+	switch {
+	case t == reflect.TypeFor[time.Time]():
+		return schema{"type": "string", "format": "date-time"}
+	case t == reflect.TypeFor[json.RawMessage]():
+		return schema{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schema{"anyOf": []schema{g.schema(t.Elem()), {"type": "null"}}}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return schema{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t, true)
+		}
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, ok := g.components[name]; !ok {
+			g.components[name] = schema{} // placeholder, for recursive types
+			g.components[name] = g.object(t, true)
+		}
+		return schema{"$ref": "#/components/schemas/" + name}
+	}
+	return schema{}
+}
+
+// object describes struct t inline. full=false describes a merge patch
+// of it instead: nothing is required and any field may be null.
+func (g *schemaGen) object(t reflect.Type, full bool) schema {
+	props := schema{}
+	required := []string{}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous || f.Tag.Get("json") == "-" {
+			continue
+		}
+		name := validate.JSONName(f)
+		s := g.schema(f.Type)
+		if tag := f.Tag.Get("validate"); tag != "" {
+			for _, rule := range strings.Split(tag, ",") {
+				rule, arg, _ := strings.Cut(rule, "=")
+				if rule == "required" {
+					required = append(required, name)
+					continue
+				}
+				s = withRule(s, f.Type, rule, arg)
+			}
+		}
+		if !full {
+			s = schema{"anyOf": []schema{s, {"type": "null"}}}
+		}
+		props[name] = s
+	}
+	out := schema{"type": "object", "properties": props, "additionalProperties": false}
+	if full && len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+// withRule adds the JSON Schema keyword for one validate rule (see
+// taskkit/validate). A $ref can't carry siblings usefully, so it is wrapped.
+func withRule(s schema, t reflect.Type, rule, arg string) schema {
+	if _, ok := s["$ref"]; ok {
+		s = schema{"allOf": []schema{s}}
+	}
+	n, _ := strconv.Atoi(arg)
+	switch rule {
+	case "readonly":
+		s["readOnly"] = true
+	case "min", "max":
+		kw := map[reflect.Kind]string{reflect.String: "Length", reflect.Slice: "Items", reflect.Map: "Properties"}[t.Kind()]
+		if kw == "" {
+			kw = map[string]string{"min": "minimum", "max": "maximum"}[rule]
+		} else {
+			kw = rule + kw
+		}
+		s[kw] = n
+	case "oneof":
+		s["enum"] = strings.Split(arg, "|")
+	case "email":
+		s["format"] = "email"
+	case "duration":
+		s["description"] = `Go duration, e.g. "30s"`
+	case "tags":
+		s["items"] = schema{"type": "string", "pattern": validate.TagPattern.String()}
+	}
+	return s
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// The contract test builds the real mux, reads the document it serves
+// and calls every documented operation through httptest, checking the
+// status, Content-Type and body of each answer against the document.
+
+type contract struct {
+	doc     map[string]any
+	handler http.Handler
+}
+
+func newContract(t *testing.T) *contract {
+	t.Helper()
+	if err := setupAuth("", "contract-test"); err != nil {
+		t.Fatal(err)
+	}
+	store = NewTaskStore()
+	seed(store)
+
+	mux := http.NewServeMux()
+	a := newAPI(mux)
+	routes(a)
+	c := &contract{handler: chain(mux, requestID, rateLimit(nil, mux), authenticate)}
+	if err := json.Unmarshal(a.doc(), &c.doc); err != nil {
+		t.Fatalf("openapi.json is not JSON: %v", err)
+	}
+	return c
+}
+
+type operation struct {
+	method, path string
+	spec         map[string]any
+}
+
+// operations lists the documented operations, DELETE last so the others
+// still find the task.
+func (c *contract) operations() []operation {
+	var ops []operation
+	for path, item := range c.doc["paths"].(map[string]any) {
+		for method, spec := range item.(map[string]any) {
+			ops = append(ops, operation{strings.ToUpper(method), path, spec.(map[string]any)})
+		}
+	}
+	slices.SortFunc(ops, func(a, b operation) int {
+		if (a.method == "DELETE") != (b.method == "DELETE") {
+			if a.method == "DELETE" {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(a.method+a.path, b.method+b.path)
+	})
+	return ops
+}
+
+// call sends op's example body to path as user key ("" = anonymous).
+func (c *contract) call(op operation, path, key string) *httptest.ResponseRecorder {
+	var body []byte
+	media := ""
+	if rb, ok := op.spec["requestBody"].(map[string]any); ok {
+		for m, content := range rb["content"].(map[string]any) {
+			media = m
+			body, _ = json.Marshal(content.(map[string]any)["example"])
+		}
+	}
+	req := httptest.NewRequest(op.method, path, bytes.NewReader(body))
+	if media != "" {
+		req.Header.Set("Content-Type", media)
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	c.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// check lists how res departs from what op documents.
+func (c *contract) check(op operation, res *httptest.ResponseRecorder) []string {
+	responses := op.spec["responses"].(map[string]any)
+	doc, ok := responses[strconv.Itoa(res.Code)].(map[string]any)
+	if !ok {
+		return []string{fmt.Sprintf("status %d is not documented", res.Code)}
+	}
+	content, ok := doc["content"].(map[string]any)
+	if !ok {
+		if res.Body.Len() > 0 {
+			return []string{fmt.Sprintf("status %d is documented without a body, got %q", res.Code, res.Body.String())}
+		}
+		return nil
+	}
+	got := res.Header().Get("Content-Type")
+	for media, m := range content {
+		if !strings.HasPrefix(got, media) {
+			return []string{fmt.Sprintf("Content-Type %q, documented %q", got, media)}
+		}
+		s, ok := m.(map[string]any)["schema"].(map[string]any)
+		if !ok {
+			return nil
+		}
+		var v any
+		if err := json.Unmarshal(res.Body.Bytes(), &v); err != nil {
+			return []string{fmt.Sprintf("body is not JSON: %v", err)}
+		}
+		return c.validate(v, s, "$", false)
+	}
+	return nil
+}
+
+// validate lists how v breaks s, for every keyword openapi.go emits. In
+// a request (request=true) readOnly properties must be absent.
+func (c *contract) validate(v any, s map[string]any, at string, request bool) []string {
+	if ref, ok := s["$ref"].(string); ok {
+		name := ref[strings.LastIndex(ref, "/")+1:]
+		s = c.doc["components"].(map[string]any)["schemas"].(map[string]any)[name].(map[string]any)
+	}
+	var errs []string
+	if all, ok := s["allOf"].([]any); ok {
+		for _, sub := range all {
+			errs = append(errs, c.validate(v, sub.(map[string]any), at, request)...)
+		}
+	}
+	if alts, ok := s["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range alts {
+			if len(c.validate(v, sub.(map[string]any), at, request)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			errs = append(errs, at+" matches none of anyOf")
+		}
+	}
+	if request && s["readOnly"] == true {
+		errs = append(errs, at+" is readOnly")
+	}
+	if enum, ok := s["enum"].([]any); ok && !slices.Contains(enum, v) {
+		errs = append(errs, fmt.Sprintf("%s = %v, not one of %v", at, v, enum))
+	}
+
+	switch s["type"] {
+	case "null":
+		if v != nil {
+			errs = append(errs, at+" should be null")
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, at+" should be a boolean")
+		}
+	case "integer", "number":
+		n, ok := v.(float64)
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Sprintf("%s should be a %s", at, s["type"]))
+		case s["type"] == "integer" && n != math.Trunc(n):
+			errs = append(errs, at+" should be an integer")
+		case s["maximum"] != nil && n > s["maximum"].(float64):
+			errs = append(errs, fmt.Sprintf("%s = %v exceeds maximum %v", at, n, s["maximum"]))
+		case s["minimum"] != nil && n < s["minimum"].(float64):
+			errs = append(errs, fmt.Sprintf("%s = %v is below minimum %v", at, n, s["minimum"]))
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			errs = append(errs, at+" should be a string")
+			break
+		}
+		if m, ok := s["maxLength"].(float64); ok && utf8.RuneCountInString(str) > int(m) {
+			errs = append(errs, fmt.Sprintf("%s is longer than %v", at, m))
+		}
+		if m, ok := s["minLength"].(float64); ok && utf8.RuneCountInString(str) < int(m) {
+			errs = append(errs, fmt.Sprintf("%s is shorter than %v", at, m))
+		}
+		if p, ok := s["pattern"].(string); ok && !regexp.MustCompile(p).MatchString(str) {
+			errs = append(errs, fmt.Sprintf("%s = %q does not match %s", at, str, p))
+		}
+		if s["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				errs = append(errs, at+" is not a date-time")
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			errs = append(errs, at+" should be an array")
+			break
+		}
+		if m, ok := s["maxItems"].(float64); ok && len(arr) > int(m) {
+			errs = append(errs, fmt.Sprintf("%s has more than %v items", at, m))
+		}
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, item := range arr {
+				errs = append(errs, c.validate(item, items, fmt.Sprintf("%s[%d]", at, i), request)...)
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			errs = append(errs, at+" should be an object")
+			break
+		}
+		props, _ := s["properties"].(map[string]any)
+		for name, pv := range obj {
+			ps, ok := props[name].(map[string]any)
+			switch {
+			case ok:
+				errs = append(errs, c.validate(pv, ps, at+"."+name, request)...)
+			case s["additionalProperties"] == false:
+				errs = append(errs, at+"."+name+" is not in the schema")
+			default:
+				if extra, ok := s["additionalProperties"].(map[string]any); ok {
+					errs = append(errs, c.validate(pv, extra, at+"."+name, request)...)
+				}
+			}
+		}
+		if req, ok := s["required"].([]any); ok {
+			for _, r := range req {
+				if _, ok := obj[r.(string)]; !ok {
+					errs = append(errs, at+"."+r.(string)+" is missing")
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func TestContractEveryRoute(t *testing.T) {
+	c := newContract(t)
+	for _, op := range c.operations() {
+		path := strings.ReplaceAll(op.path, "{id}", "2") // seeded, owned by alice
+		res := c.call(op, path, "alice-key")
+		if res.Code >= 400 {
+			t.Errorf("%s %s → %d with the documented example: %s", op.method, op.path, res.Code, res.Body)
+			continue
+		}
+		for _, p := range c.check(op, res) {
+			t.Errorf("%s %s → %d: %s", op.method, op.path, res.Code, p)
+		}
+	}
+}
+
+func TestContractExamplesMatchRequestSchemas(t *testing.T) {
+	c := newContract(t)
+	for _, op := range c.operations() {
+		rb, ok := op.spec["requestBody"].(map[string]any)
+		if !ok {
+			continue
+		}
+		for media, content := range rb["content"].(map[string]any) {
+			m := content.(map[string]any)
+			example, ok := m["example"]
+			if !ok {
+				t.Errorf("%s %s: %s body has no example", op.method, op.path, media)
+				continue
+			}
+			for _, p := range c.validate(example, m["schema"].(map[string]any), "$", true) {
+				t.Errorf("%s %s example: %s", op.method, op.path, p)
+			}
+		}
+	}
+}
+
+func TestContractErrorResponses(t *testing.T) {
+	c := newContract(t)
+	for _, op := range c.operations() {
+		if strings.HasPrefix(op.path, "/api/") {
+			res := c.call(op, op.path, "")
+			if res.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s without credentials → %d; want 401", op.method, op.path, res.Code)
+			}
+			for _, p := range c.check(op, res) {
+				t.Errorf("%s %s → %d: %s", op.method, op.path, res.Code, p)
+			}
+		}
+		if strings.Contains(op.path, "{id}") {
+			res := c.call(op, strings.ReplaceAll(op.path, "{id}", "no-such-task"), "alice-key")
+			for _, p := range c.check(op, res) {
+				t.Errorf("%s %s (unknown id) → %d: %s", op.method, op.path, res.Code, p)
+			}
+		}
+	}
+}
+
+// The validator itself must catch what the document forbids, or the
+// tests above prove nothing.
+func TestContractValidatorRejects(t *testing.T) {
+	c := newContract(t)
+	task := map[string]any{"$ref": "#/components/schemas/Task"}
+	good := map[string]any{"id": "1", "title": "ok", "done": false, "ownerId": "alice",
+		"createdAt": "2030-01-01T00:00:00Z", "updatedAt": "2030-01-01T00:00:00Z", "version": float64(1)}
+	if errs := c.validate(good, task, "$", false); len(errs) > 0 {
+		t.Fatalf("valid task rejected: %v", errs)
+	}
+	for name, mutate := range map[string]func(map[string]any){
+		"unknown property": func(m map[string]any) { m["extra"] = 1 },
+		"missing required": func(m map[string]any) { delete(m, "title") },
+		"wrong type":       func(m map[string]any) { m["done"] = "yes" },
+		"maxLength":        func(m map[string]any) { m["title"] = strings.Repeat("x", 201) },
+		"not an integer":   func(m map[string]any) { m["version"] = 1.5 },
+		"bad date-time":    func(m map[string]any) { m["createdAt"] = "yesterday" },
+		"tag pattern":      func(m map[string]any) { m["tags"] = []any{"Not A Tag"} },
+	} {
+		bad := make(map[string]any)
+		for k, v := range good {
+			bad[k] = v
+		}
+		mutate(bad)
+		if errs := c.validate(bad, task, "$", false); len(errs) == 0 {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	if errs := c.validate(map[string]any{"title": "x", "ownerId": "bob"}, task, "$", true); len(errs) == 0 {
+		t.Error("readOnly ownerId accepted in a request")
+	}
+	if errs := c.validate("b", map[string]any{"type": "string", "enum": []any{"a"}}, "$", false); len(errs) == 0 {
+		t.Error("enum not enforced")
+	}
+}
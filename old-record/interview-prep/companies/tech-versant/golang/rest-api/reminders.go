@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+)
+
+// ─── DUE DATES AND REMINDERS ───
+//
+// remindLoop checks the store every -remind-every and calls notify once
+// for each open task whose dueAt is less than -remind-before away. The
+// reminder is per due time: moving dueAt arms it again.
+
+var (
+	remindBefore = flag.Duration("remind-before", 15*time.Minute, "remind about open tasks due within this window (0 disables)")
+	remindEvery  = flag.Duration("remind-every", 30*time.Second, "how often due dates are checked")
+)
+
+// overdue reports whether t is still open past its due time.
+func (t Task) overdue(now time.Time) bool {
+	return t.open() && t.DueAt != nil && t.DueAt.Before(now)
+}
+
+type reminders struct {
+	before time.Duration
+	sent   map[string]time.Time // task ID → the dueAt already reminded about
+	notify func(Task)
+}
+
+// check reminds about tasks that entered the window and forgets those
+// that left it (done, deleted, overdue or moved out).
+func (rm *reminders) check(tasks []Task, now time.Time) {
+	inWindow := make(map[string]bool)
+	for _, t := range tasks {
+		if !t.open() || t.DueAt == nil {
+			continue
+		}
+		if left := t.DueAt.Sub(now); left <= 0 || left > rm.before {
+			continue
+		}
+		inWindow[t.ID] = true
+		if at, ok := rm.sent[t.ID]; ok && at.Equal(*t.DueAt) {
+			continue
+		}
+		rm.sent[t.ID] = *t.DueAt
+		rm.notify(t)
+	}
+	for id := range rm.sent {
+		if !inWindow[id] {
+			delete(rm.sent, id)
+		}
+	}
+}
+
+func remindLoop(ctx context.Context, repo TaskRepository, before, every time.Duration, notify func(Task)) {
+	rm := &reminders{before: before, sent: make(map[string]time.Time), notify: notify}
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		rm.check(repo.GetAll(), time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
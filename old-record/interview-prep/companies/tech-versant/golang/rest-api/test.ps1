@@ -1,6 +1,11 @@
 # ─── TEST REST API (PowerShell) ───
 # Run: .\test.ps1 (while server is running in another terminal)
 
+# Every /api call authenticates as alice (demo key); -Headers below adds to it.
+$auth = @{ "X-API-Key" = "alice-key" }
+$PSDefaultParameterValues["Invoke-RestMethod:Headers"] = $auth
+$PSDefaultParameterValues["Invoke-WebRequest:Headers"] = $auth
+
 Write-Host "═══ GET all tasks ═══" -ForegroundColor Cyan
 Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method GET | ConvertTo-Json
 
@@ -14,4 +19,158 @@ Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body $body
 Write-Host "`n═══ GET all tasks (after POST) ═══" -ForegroundColor Cyan
 Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method GET | ConvertTo-Json
 
+Write-Host "`n═══ PUT replace task 1 ═══" -ForegroundColor Cyan
+$body = @{ title = "Renamed"; done = $false } | ConvertTo-Json
+Invoke-RestMethod -Uri http://localhost:8080/api/tasks/1 -Method PUT -Body $body -ContentType "application/json" | ConvertTo-Json
+
+Write-Host "`n═══ PATCH toggle done on task 2 ═══" -ForegroundColor Cyan
+$body = @{ done = $true } | ConvertTo-Json
+Invoke-RestMethod -Uri http://localhost:8080/api/tasks/2 -Method PATCH -Body $body -ContentType "application/merge-patch+json" | ConvertTo-Json
+
+Write-Host "`n═══ DELETE task 1 ═══" -ForegroundColor Cyan
+Invoke-WebRequest -Uri http://localhost:8080/api/tasks/1 -Method DELETE | Select-Object StatusCode
+
+Write-Host "`n═══ GET all tasks (after PUT/PATCH/DELETE) ═══" -ForegroundColor Cyan
+Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method GET | ConvertTo-Json
+
+Write-Host "`n═══ X-Request-ID: echoed back and logged with the request ═══" -ForegroundColor Cyan
+$resp = Invoke-WebRequest -Uri http://localhost:8080/api/tasks -Method GET -Headers ($auth + @{ "X-Request-ID" = "demo-req-1" })
+$resp.Headers["X-Request-ID"]
+
+Write-Host "`n═══ Metrics (Prometheus text format) ═══" -ForegroundColor Cyan
+(Invoke-WebRequest -Uri http://localhost:8080/metrics -Method GET).Content -split "`n" | Where-Object { $_ -match '^http_requests_total' }
+Write-Host "`n═══ Ownership: bob sees none of alice's tasks, admin sees all ═══" -ForegroundColor Cyan
+(Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method GET -Headers @{ "X-API-Key" = "bob-key" }).Count
+(Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method GET -Headers @{ "X-API-Key" = "admin-key" }).Count
+$tok = (Invoke-RestMethod -Uri http://localhost:8080/api/tokens -Method POST).token
+Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method GET -Headers @{ Authorization = "Bearer $tok" } | ConvertTo-Json
+
+Write-Host "`n═══ Rate limit: burst of POSTs until 429 ═══" -ForegroundColor Cyan
+foreach ($i in 1..15) {
+    try {
+        $r = Invoke-WebRequest -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Burst $i" } | ConvertTo-Json) -ContentType "application/json"
+        "$i → $($r.StatusCode) remaining=$($r.Headers['X-RateLimit-Remaining'])"
+    } catch {
+        "$i → $([int]$_.Exception.Response.StatusCode) Retry-After=$($_.Exception.Response.Headers['Retry-After'])"
+    }
+}
+
+Write-Host "`n═══ Validation: every field error in one application/problem+json ═══" -ForegroundColor Cyan
+try {
+    Invoke-WebRequest -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = ""; ownerId = "bob"; extra = 1 } | ConvertTo-Json) -ContentType "application/json"
+} catch {
+    $_.ErrorDetails.Message
+}
+
+Write-Host "`n═══ Idempotency-Key: retried POST returns the same task ═══" -ForegroundColor Cyan
+$key = [guid]::NewGuid().ToString()
+$first = Invoke-WebRequest -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Exactly once" } | ConvertTo-Json) -ContentType "application/json" -Headers @{ "Idempotency-Key" = $key }
+$again = Invoke-WebRequest -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Exactly once" } | ConvertTo-Json) -ContentType "application/json" -Headers @{ "Idempotency-Key" = $key }
+"$(($first.Content | ConvertFrom-Json).id) == $(($again.Content | ConvertFrom-Json).id)  replayed=$($again.Headers['Idempotent-Replayed'])"
+try {
+    Invoke-WebRequest -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Something else" } | ConvertTo-Json) -ContentType "application/json" -Headers @{ "Idempotency-Key" = $key }
+} catch {
+    "different body → $([int]$_.Exception.Response.StatusCode)"
+}
+
+Write-Host "`n═══ ETags: 304 on If-None-Match, 412 on a stale If-Match ═══" -ForegroundColor Cyan
+$t = Invoke-WebRequest -Uri http://localhost:8080/api/tasks/2 -Method GET
+$tag = $t.Headers['ETag']
+try { Invoke-WebRequest -Uri http://localhost:8080/api/tasks/2 -Method GET -Headers @{ "If-None-Match" = $tag } } catch { "If-None-Match $tag → $([int]$_.Exception.Response.StatusCode)" }
+$r = Invoke-WebRequest -Uri http://localhost:8080/api/tasks/2 -Method PATCH -Body '{"title":"Versioned"}' -ContentType "application/merge-patch+json" -Headers @{ "If-Match" = $tag }
+"If-Match $tag → $($r.StatusCode), new ETag $($r.Headers['ETag'])"
+try {
+    Invoke-WebRequest -Uri http://localhost:8080/api/tasks/2 -Method PATCH -Body '{"title":"Lost update"}' -ContentType "application/merge-patch+json" -Headers @{ "If-Match" = $tag }
+} catch {
+    "If-Match $tag again → $([int]$_.Exception.Response.StatusCode)"
+}
+
+Write-Host "`n═══ Tags and due dates: ?tag= uses the index, ?overdue=true ═══" -ForegroundColor Cyan
+Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Late report"; tags = @("Reports", "ops"); dueAt = (Get-Date).ToUniversalTime().AddHours(-1).ToString("o") } | ConvertTo-Json) -ContentType "application/json" | ConvertTo-Json
+(Invoke-RestMethod -Uri "http://localhost:8080/api/tasks?tag=reports" -Method GET).title
+(Invoke-RestMethod -Uri "http://localhost:8080/api/tasks?overdue=true" -Method GET).title
+
+Write-Host "`n═══ Contract: every route in /openapi.json answers as documented ═══" -ForegroundColor Cyan
+$spec = Invoke-RestMethod -Uri http://localhost:8080/openapi.json -Method GET
+
+# Test-Schema lists how $value breaks $schema, for the keywords openapi.go emits.
+function Test-Schema($value, $schema, $at = '$') {
+    if ($schema.'$ref') { $schema = $spec.components.schemas.($schema.'$ref'.Split('/')[-1]) }
+    if ($schema.anyOf) {
+        if ($null -eq $value) { return }
+        $schema = $schema.anyOf[0]
+    }
+    switch ($schema.type) {
+        'array' {
+            $i = 0
+            foreach ($v in @($value)) { Test-Schema $v $schema.items "$at[$i]"; $i++ }
+        }
+        'object' {
+            if (-not $schema.properties) { return }
+            $names = $schema.properties.PSObject.Properties.Name
+            foreach ($p in $value.PSObject.Properties) {
+                if ($names -notcontains $p.Name) { "$at.$($p.Name) is not in the schema" }
+                else { Test-Schema $p.Value $schema.properties.($p.Name) "$at.$($p.Name)" }
+            }
+            foreach ($r in @($schema.required)) {
+                if ($r -and $value.PSObject.Properties.Name -notcontains $r) { "$at.$r is missing" }
+            }
+        }
+        'string'  { if ($value -isnot [string] -and $value -isnot [datetime]) { "$at should be a string" } }
+        'boolean' { if ($value -isnot [bool]) { "$at should be a boolean" } }
+        'integer' { if ($value -isnot [int] -and $value -isnot [long]) { "$at should be an integer" } }
+    }
+}
+
+function Invoke-Route($method, $uri, $body, $contentType) {
+    $req = @{ Uri = $uri; Method = $method; UseBasicParsing = $true }
+    if ($body) { $req.Body = $body; $req.ContentType = $contentType }
+    try {
+        $r = Invoke-WebRequest @req
+        return @{ Status = [int]$r.StatusCode; Type = "$($r.Headers['Content-Type'])"; Body = $r.Content }
+    } catch {
+        $resp = $_.Exception.Response
+        $type = if ($resp.Content) { "$($resp.Content.Headers.ContentType)" } else { $resp.ContentType }
+        return @{ Status = [int]$resp.StatusCode; Type = $type; Body = $_.ErrorDetails.Message }
+    }
+}
+
+$seed = Invoke-RestMethod -Uri http://localhost:8080/api/tasks -Method POST -Body (@{ title = "Contract" } | ConvertTo-Json) -ContentType "application/json"
+$failures = 0
+foreach ($route in $spec.paths.PSObject.Properties) {
+    # DELETE last, so the other operations still find the task
+    foreach ($m in $route.Value.PSObject.Properties | Sort-Object { $_.Name -eq 'delete' }) {
+        $op = $m.Value
+        $uri = "http://localhost:8080" + $route.Name.Replace('{id}', $seed.id)
+        $body = $null; $ct = $null
+        if ($op.requestBody) {
+            $media = @($op.requestBody.content.PSObject.Properties)[0]
+            $ct = $media.Name
+            $body = $media.Value.example | ConvertTo-Json -Depth 10
+        }
+        $res = Invoke-Route $m.Name.ToUpper() $uri $body $ct
+
+        $problems = @()
+        $doc = $op.responses."$($res.Status)"
+        if (-not $doc) {
+            $problems += "status $($res.Status) is not documented"
+        } elseif ($doc.content) {
+            $media = @($doc.content.PSObject.Properties)[0]
+            if ($res.Type -notlike "$($media.Name)*") {
+                $problems += "Content-Type $($res.Type), documented $($media.Name)"
+            } elseif ($media.Value.schema) {
+                $problems += Test-Schema ($res.Body | ConvertFrom-Json) $media.Value.schema
+            }
+        }
+        $problems = @($problems | Where-Object { $_ })
+        if ($problems) {
+            $failures++
+            Write-Host "✗ $($m.Name.ToUpper()) $($route.Name) → $($res.Status): $($problems -join '; ')" -ForegroundColor Red
+        } else {
+            "✓ $($m.Name.ToUpper()) $($route.Name) → $($res.Status)"
+        }
+    }
+}
+"$failures contract failure(s)"
+
 Write-Host "`n✅ All requests done!" -ForegroundColor Green
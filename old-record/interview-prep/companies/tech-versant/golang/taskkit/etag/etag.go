@@ -0,0 +1,54 @@
+// Package etag turns the store-maintained version of a task into an ETag
+// and checks the conditional headers of rest-api and rest-api-concurrent
+// against it.
+package etag
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ─── ETAGS (optimistic concurrency) ───
+//
+// A task's ETag is its store-maintained Version, e.g. "7". Clients send it
+// back as
+//
+//	If-None-Match: "7"   on GET    → 304 while the task is unchanged
+//	If-Match: "7"        on writes → 412 if someone else wrote in between
+//
+// Writes without If-Match still go through CompareAndSwap against the
+// version the handler read, so a racing write is refused instead of
+// silently lost.
+
+// Of returns the ETag of a task at version.
+func Of(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// IfMatch reports whether the request's If-Match (if any) allows writing
+// over a task at version. Comparison is strong: W/ tags never match.
+func IfMatch(r *http.Request, version int64) bool {
+	h := r.Header.Get("If-Match")
+	return h == "" || listed(h, Of(version), false)
+}
+
+// NotModified reports whether the request's If-None-Match already names
+// version. Comparison is weak, as RFC 9110 asks for GET.
+func NotModified(r *http.Request, version int64) bool {
+	h := r.Header.Get("If-None-Match")
+	return h != "" && listed(h, Of(version), true)
+}
+
+func listed(header, tag string, weak bool) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if weak {
+			v = strings.TrimPrefix(v, "W/")
+		}
+		if v == "*" || v == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,3 @@
+module taskkit
+
+go 1.25.6
@@ -0,0 +1,235 @@
+// Package idempotency lets clients of rest-api and rest-api-concurrent
+// retry a POST safely with an Idempotency-Key header.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"taskkit/validate"
+)
+
+// ─── IDEMPOTENCY KEYS ───
+//
+// A client that sends "Idempotency-Key: <key>" with a POST can retry it
+// safely: the first successful response is stored per (user, key) and
+// replayed byte for byte, with "Idempotent-Replayed: true", for -idempotency-ttl.
+//
+//	same key, same body        → stored response replayed, nothing re-runs
+//	same key, different body   → 422
+//	same key, first still busy → 409, retry later
+//
+// Only 2xx responses are kept: after a 429 or 503 the retry runs again.
+// Keys live in memory, so a restart forgets them.
+
+var TTL = flag.Duration("idempotency-ttl", 24*time.Hour, "how long Idempotency-Key responses are replayed")
+
+const maxKey = 255
+
+// replayHeaders are the response headers stored with an entry. The rest
+// (X-Request-ID, X-RateLimit-*) describe the request being answered now.
+var replayHeaders = []string{"Content-Type", "Location", "ETag"}
+
+type idemKey struct {
+	user, key string
+}
+
+type idemEntry struct {
+	fingerprint [sha256.Size]byte
+	done        bool // false while the first request is in flight
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+type keyStore struct {
+	mu      sync.Mutex
+	entries map[idemKey]*idemEntry
+}
+
+var keys = &keyStore{entries: make(map[idemKey]*idemEntry)}
+
+var (
+	errKeyInFlight = errors.New("a request with this Idempotency-Key is still in progress")
+	errKeyReused   = errors.New("Idempotency-Key was already used with a different request")
+)
+
+// begin reserves k for a new request, or returns the finished entry to
+// replay.
+func (s *keyStore) begin(k idemKey, fp [sha256.Size]byte, now time.Time) (*idemEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[k]
+	if ok && now.After(e.expires) && e.done {
+		ok = false
+	}
+	if !ok {
+		s.entries[k] = &idemEntry{fingerprint: fp, expires: now.Add(*TTL)}
+		return nil, nil
+	}
+	if e.fingerprint != fp {
+		return nil, errKeyReused
+	}
+	if !e.done {
+		return nil, errKeyInFlight
+	}
+	return e, nil
+}
+
+// finish stores a 2xx response for replay, or frees the key otherwise.
+func (s *keyStore) finish(k idemKey, status int, header http.Header, body []byte, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status < 200 || status > 299 {
+		delete(s.entries, k)
+		return
+	}
+	e := s.entries[k]
+	e.done, e.status, e.header, e.body = true, status, header, body
+	e.expires = now.Add(*TTL)
+}
+
+func (s *keyStore) evictExpired(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for k, e := range s.entries {
+		if e.done && now.After(e.expires) {
+			delete(s.entries, k)
+			n++
+		}
+	}
+	return n
+}
+
+// EvictLoop drops expired keys every interval until ctx is cancelled.
+func EvictLoop(ctx context.Context, every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			if n := keys.evictExpired(now); n > 0 {
+				slog.Debug("evicted idempotency keys", "count", n)
+			}
+		}
+	}
+}
+
+// captureWriter tees a response so it can be stored for replay.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *captureWriter) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// Middleware makes a POST handler honour Idempotency-Key. Keys are
+// scoped to the caller that user names, so two users can't replay each
+// other's responses.
+func Middleware(user func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !validKey(key) {
+				validate.WriteProblem(w, validate.Problem{Status: http.StatusBadRequest,
+					Detail: "Idempotency-Key must be 1-255 printable ASCII characters"})
+				return
+			}
+
+			// The body is part of the fingerprint, so read it here and hand
+			// the handler a fresh reader over the same bytes.
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, *validate.MaxBodyBytes))
+			if err != nil {
+				validate.WriteDecodeError(w, validate.ErrBodyTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			h := sha256.New()
+			io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+			h.Write(body)
+			var fp [sha256.Size]byte
+			h.Sum(fp[:0])
+
+			k := idemKey{user: user(r), key: key}
+			e, err := keys.begin(k, fp, time.Now())
+			switch {
+			case errors.Is(err, errKeyReused):
+				validate.WriteProblem(w, validate.Problem{Status: http.StatusUnprocessableEntity, Detail: err.Error()})
+				return
+			case errors.Is(err, errKeyInFlight):
+				w.Header().Set("Retry-After", "1")
+				validate.WriteProblem(w, validate.Problem{Status: http.StatusConflict, Detail: err.Error()})
+				return
+			case e != nil:
+				for name, vals := range e.header {
+					w.Header()[name] = slices.Clone(vals)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(e.status)
+				w.Write(e.body)
+				return
+			}
+
+			cw := &captureWriter{ResponseWriter: w}
+			defer func() {
+				// also runs if the handler panics, so the key is not stuck in flight
+				status := cw.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+				header := make(http.Header)
+				for _, name := range replayHeaders {
+					if v := w.Header().Values(name); len(v) > 0 {
+						header[name] = v
+					}
+				}
+				keys.finish(k, status, header, cw.body.Bytes(), time.Now())
+			}()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// validKey accepts 1-255 printable ASCII characters, no spaces.
+func validKey(key string) bool {
+	if key == "" || len(key) > maxKey {
+		return false
+	}
+	for _, c := range key {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+// Package ids mints the task, project and schedule IDs of rest-api and
+// rest-api-concurrent.
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// ─── IDS (UUIDv7, RFC 9562) ───
+//
+// Time-ordered IDs: 48 bits of Unix milliseconds, then a 12-bit counter
+// that keeps IDs minted in the same millisecond ordered, then 62 random
+// bits. Unlike the old UnixNano strings, two requests landing on the same
+// clock tick (or two servers sharing a data file) cannot collide.
+
+var idGen struct {
+	mu     sync.Mutex
+	lastMs int64
+	seq    uint16 // 12 bits used
+}
+
+// New returns a fresh UUIDv7 in its 36-character text form.
+func New() string {
+	var b [16]byte
+	rand.Read(b[:])
+
+	idGen.mu.Lock()
+	ms := time.Now().UnixMilli()
+	if ms <= idGen.lastMs {
+		// same millisecond, or the clock stepped back: count on from the last ID
+		ms = idGen.lastMs
+		idGen.seq++
+		if idGen.seq > 0xfff {
+			ms++
+			idGen.seq = 0
+		}
+	} else {
+		idGen.seq = 0
+	}
+	idGen.lastMs = ms
+	seq := idGen.seq
+	idGen.mu.Unlock()
+
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(ms))
+	copy(b[0:6], ts[2:8])
+	b[6] = 0x70 | byte(seq>>8) // version 7
+	b[7] = byte(seq)
+	b[8] = 0x80 | b[8]&0x3f // variant 10
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:36], b[10:16])
+	return string(s[:])
+}
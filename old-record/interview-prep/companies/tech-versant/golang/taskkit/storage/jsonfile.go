@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ─── JSON SNAPSHOT STORE ───
+//
+// Keeps everything in memory and rewrites the whole file on every
+// mutation. The write goes to a temp file that is renamed over the old
+// one, so a crash leaves either the previous or the new snapshot, never
+// a half-written file. Fine for small task lists; use the log backend
+// when writes are frequent.
+
+type JSONFile[T Record[T]] struct {
+	mu   sync.Mutex // serialises mutations so memory and disk agree
+	mem  *Memory[T]
+	path string
+}
+
+func OpenJSONFile[T Record[T]](path string) (*JSONFile[T], error) {
+	s := &JSONFile[T]{mem: NewMemory[T](), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var items []T
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	for _, t := range items {
+		s.mem.put(t)
+	}
+	return s, nil
+}
+
+func (s *JSONFile[T]) GetAll() []T              { return s.mem.GetAll() }
+func (s *JSONFile[T]) Get(key string) (T, bool) { return s.mem.Get(key) }
+func (s *JSONFile[T]) ByTag(tag string) []T     { return s.mem.ByTag(tag) }
+
+func (s *JSONFile[T]) Set(t T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.write(t)
+	return err
+}
+
+func (s *JSONFile[T]) CompareAndSwap(t T, version int64) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prev, _ := s.mem.Get(t.StoreKey()); versionOf(prev) != version {
+		var zero T
+		return zero, ErrVersionConflict
+	}
+	return s.write(t)
+}
+
+// write stores t as the next version of its task. Callers hold s.mu.
+func (s *JSONFile[T]) write(t T) (T, error) {
+	prev, existed := s.mem.Get(t.StoreKey())
+	t = next(t, prev, existed)
+	s.mem.put(t)
+	if err := s.flush(); err != nil {
+		// roll back so memory never runs ahead of disk
+		if existed {
+			s.mem.put(prev)
+		} else {
+			s.mem.Delete(t.StoreKey())
+		}
+		var zero T
+		return zero, err
+	}
+	return t, nil
+}
+
+func (s *JSONFile[T]) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.mem.Get(key)
+	if !ok {
+		return ErrNotFound
+	}
+	s.mem.Delete(key)
+	if err := s.flush(); err != nil {
+		s.mem.put(prev)
+		return err
+	}
+	return nil
+}
+
+func (s *JSONFile[T]) Close() error { return nil }
+
+// flush writes the snapshot atomically.
+func (s *JSONFile[T]) flush() error {
+	data, err := json.MarshalIndent(s.mem.GetAll(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+	return WriteFileAtomic(s.path, data)
+}
+
+// WriteFileAtomic replaces path with data via temp file + fsync + rename,
+// so readers see either the old or the new content, never a mix.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("syncing snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing snapshot: %w", err)
+	}
+	return nil
+}
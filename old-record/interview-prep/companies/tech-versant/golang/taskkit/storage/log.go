@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ─── APPEND-ONLY LOG STORE ───
+//
+// Every mutation is appended as one JSON line and fsynced before the
+// in-memory map is updated. On startup the log is replayed to rebuild
+// state. A crash mid-append leaves a torn last line; replay stops there
+// and truncates it away, so the store always reopens cleanly.
+//
+// The log is compacted on open (rewritten with one "set" per live task)
+// when it holds noticeably more records than tasks.
+
+type logRecord[T any] struct {
+	Op   string `json:"op"` // "set" | "delete"
+	Task *T     `json:"task,omitempty"`
+	ID   string `json:"id,omitempty"` // store key of a deleted task
+}
+
+type Log[T Record[T]] struct {
+	mu   sync.Mutex // serialises appends
+	mem  *Memory[T]
+	path string
+	file *os.File
+}
+
+func OpenLog[T Record[T]](path string) (*Log[T], error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+
+	s := &Log[T]{mem: NewMemory[T](), path: path, file: f}
+	records, err := s.replay()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if live := len(s.mem.GetAll()); records > 2*live+100 {
+		if err := s.compact(); err != nil {
+			s.file.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// replay applies every complete record and truncates a torn tail.
+func (s *Log[T]) replay() (int, error) {
+	r := bufio.NewReader(s.file)
+	var good int64 // offset just past the last valid record
+	records := 0
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// anything without a trailing newline is a torn write
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("reading %s: %w", s.path, err)
+		}
+
+		var rec logRecord[T]
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return 0, fmt.Errorf("%s: corrupt record at offset %d: %w", s.path, good, err)
+		}
+		switch {
+		case rec.Op == "set" && rec.Task != nil:
+			s.mem.put(*rec.Task)
+		case rec.Op == "delete":
+			s.mem.Delete(rec.ID)
+		default:
+			return 0, fmt.Errorf("%s: unknown record %q at offset %d", s.path, rec.Op, good)
+		}
+		good += int64(len(line))
+		records++
+	}
+
+	if err := s.file.Truncate(good); err != nil {
+		return 0, fmt.Errorf("truncating %s: %w", s.path, err)
+	}
+	if _, err := s.file.Seek(good, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seeking %s: %w", s.path, err)
+	}
+	return records, nil
+}
+
+// compact rewrites the log as one "set" per live task and swaps it in.
+func (s *Log[T]) compact() error {
+	tmpPath := s.path + ".compact"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("compacting %s: %w", s.path, err)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, t := range s.mem.GetAll() {
+		if err := enc.Encode(logRecord[T]{Op: "set", Task: &t}); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("compacting %s: %w", s.path, err)
+		}
+	}
+	if err := w.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("compacting %s: %w", s.path, err)
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("compacting %s: %w", s.path, err)
+	}
+	s.file.Close()
+	s.file = tmp // already positioned at the end
+	return nil
+}
+
+func (s *Log[T]) append(rec logRecord[T]) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encoding record: %w", err)
+	}
+	end, err := s.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("appending to %s: %w", s.path, err)
+	}
+	if _, err = s.file.Write(append(line, '\n')); err == nil {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		// drop the partial record so later appends stay parseable
+		s.file.Truncate(end)
+		s.file.Seek(end, io.SeekStart)
+		return fmt.Errorf("appending to %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *Log[T]) GetAll() []T              { return s.mem.GetAll() }
+func (s *Log[T]) Get(key string) (T, bool) { return s.mem.Get(key) }
+func (s *Log[T]) ByTag(tag string) []T     { return s.mem.ByTag(tag) }
+
+func (s *Log[T]) Set(t T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.write(t)
+	return err
+}
+
+func (s *Log[T]) CompareAndSwap(t T, version int64) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prev, _ := s.mem.Get(t.StoreKey()); versionOf(prev) != version {
+		var zero T
+		return zero, ErrVersionConflict
+	}
+	return s.write(t)
+}
+
+// write appends t as the next version of its task. Callers hold s.mu.
+func (s *Log[T]) write(t T) (T, error) {
+	prev, existed := s.mem.Get(t.StoreKey())
+	t = next(t, prev, existed)
+	if err := s.append(logRecord[T]{Op: "set", Task: &t}); err != nil {
+		var zero T
+		return zero, err
+	}
+	s.mem.put(t)
+	return t, nil
+}
+
+func (s *Log[T]) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.mem.Get(key); !ok {
+		return ErrNotFound
+	}
+	if err := s.append(logRecord[T]{Op: "delete", ID: key}); err != nil {
+		return err
+	}
+	return s.mem.Delete(key)
+}
+
+func (s *Log[T]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,110 @@
+package storage
+
+import "sync"
+
+// ─── IN-MEMORY STORE (sync.RWMutex) ───
+
+type Memory[T Record[T]] struct {
+	mu    sync.RWMutex
+	items map[string]T
+	byTag map[string]map[string]struct{} // tag → keys of the records carrying it
+}
+
+func NewMemory[T Record[T]]() *Memory[T] {
+	return &Memory[T]{items: make(map[string]T), byTag: make(map[string]map[string]struct{})}
+}
+
+func (s *Memory[T]) GetAll() []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]T, 0, len(s.items))
+	for _, t := range s.items {
+		result = append(result, t)
+	}
+	return result
+}
+
+func (s *Memory[T]) Get(key string) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.items[key]
+	return t, ok
+}
+
+func (s *Memory[T]) ByTag(tag string) []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := s.byTag[tag]
+	result := make([]T, 0, len(keys))
+	for key := range keys {
+		result = append(result, s.items[key])
+	}
+	return result
+}
+
+func (s *Memory[T]) Set(t T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, existed := s.items[t.StoreKey()]
+	s.store(next(t, prev, existed))
+	return nil
+}
+
+func (s *Memory[T]) CompareAndSwap(t T, version int64) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, existed := s.items[t.StoreKey()]
+	if versionOf(prev) != version {
+		var zero T
+		return zero, ErrVersionConflict
+	}
+	t = next(t, prev, existed)
+	s.store(t)
+	return t, nil
+}
+
+// put stores t as is. The file backends use it to load and to roll back,
+// where the version was already decided.
+func (s *Memory[T]) put(t T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store(t)
+}
+
+func (s *Memory[T]) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.items[key]
+	if !ok {
+		return ErrNotFound
+	}
+	s.unindex(prev)
+	delete(s.items, key)
+	return nil
+}
+
+func (s *Memory[T]) Close() error { return nil }
+
+// store saves t and keeps byTag in step. Callers hold s.mu.
+func (s *Memory[T]) store(t T) {
+	key := t.StoreKey()
+	if prev, ok := s.items[key]; ok {
+		s.unindex(prev)
+	}
+	s.items[key] = t
+	for _, tag := range t.StoreTags() {
+		if s.byTag[tag] == nil {
+			s.byTag[tag] = make(map[string]struct{})
+		}
+		s.byTag[tag][key] = struct{}{}
+	}
+}
+
+func (s *Memory[T]) unindex(t T) {
+	for _, tag := range t.StoreTags() {
+		delete(s.byTag[tag], t.StoreKey())
+		if len(s.byTag[tag]) == 0 {
+			delete(s.byTag, tag)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Package storage holds the task storage backends shared by rest-api and
+// rest-api-concurrent: an in-memory map (Memory), a JSON snapshot file
+// (JSONFile) and an append-only log (Log).
+//
+// The backends are generic over the record they keep, so each module
+// stores its own Task type; Record is what they need from it. Every
+// backend owns the version and the timestamps: each write stores the
+// record as the previous version + 1, whatever the caller passed in.
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound        = errors.New("task not found")
+	ErrVersionConflict = errors.New("task was modified concurrently")
+)
+
+// Record is implemented by the value type T a backend stores.
+type Record[T any] interface {
+	StoreKey() string    // what Get and Delete look it up by
+	StoreTags() []string // what ByTag finds it by
+	// StoreMeta returns the version and creation time last stamped on it.
+	StoreMeta() (version int64, createdAt time.Time)
+	// WithMeta returns a copy stamped with version and timestamps.
+	WithMeta(version int64, createdAt, updatedAt time.Time) T
+}
+
+// next returns t as it should be stored over prev (existed=false: t is
+// new): the version is bumped, createdAt kept from prev or set on first
+// write, updatedAt is now.
+func next[T Record[T]](t, prev T, existed bool) T {
+	now := time.Now()
+	version, created := prev.StoreMeta()
+	if !existed {
+		if _, created = t.StoreMeta(); created.IsZero() {
+			created = now
+		}
+	}
+	return t.WithMeta(version+1, created, now)
+}
+
+func versionOf[T Record[T]](t T) int64 {
+	version, _ := t.StoreMeta()
+	return version
+}
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Every backend must pass the same suite; the file-backed ones must also
+// come back unchanged after a reopen. They are run over item, a cut-down
+// task; the modules' Task types store the same way.
+
+type item struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Version   int64     `json:"version"`
+}
+
+func (t item) StoreKey() string              { return t.ID }
+func (t item) StoreTags() []string           { return t.Tags }
+func (t item) StoreMeta() (int64, time.Time) { return t.Version, t.CreatedAt }
+func (t item) WithMeta(v int64, c, u time.Time) item {
+	t.Version, t.CreatedAt, t.UpdatedAt = v, c, u
+	return t
+}
+
+// repository is the method set the modules' TaskRepository asks for.
+type repository interface {
+	GetAll() []item
+	Get(key string) (item, bool)
+	ByTag(tag string) []item
+	Set(t item) error
+	CompareAndSwap(t item, version int64) (item, error)
+	Delete(key string) error
+	Close() error
+}
+
+type backend struct {
+	name string
+	open func(path string) (repository, error) // path is unused by memory
+	disk bool
+}
+
+var backends = []backend{
+	{"memory", func(string) (repository, error) { return NewMemory[item](), nil }, false},
+	{"json", func(p string) (repository, error) { return OpenJSONFile[item](p) }, true},
+	{"log", func(p string) (repository, error) { return OpenLog[item](p) }, true},
+}
+
+func eachBackend(t *testing.T, test func(t *testing.T, b backend, path string, repo repository)) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tasks.data")
+			repo, err := b.open(path)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			t.Cleanup(func() { repo.Close() })
+			test(t, b, path, repo)
+		})
+	}
+}
+
+func ids(tasks []item) []string {
+	out := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		out = append(out, t.ID)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestRepositoryGetSetDelete(t *testing.T) {
+	eachBackend(t, func(t *testing.T, _ backend, _ string, repo repository) {
+		if _, ok := repo.Get("a"); ok {
+			t.Fatal("Get on an empty store found a task")
+		}
+		if err := repo.Set(item{ID: "a", Title: "first"}); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		if err := repo.Set(item{ID: "b", Title: "second"}); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+
+		a, ok := repo.Get("a")
+		if !ok || a.Title != "first" || a.Version != 1 {
+			t.Fatalf("Get(a) = %+v, %v; want title first, version 1", a, ok)
+		}
+		if a.CreatedAt.IsZero() || a.UpdatedAt.IsZero() {
+			t.Fatalf("Get(a) = %+v; want the store to set the timestamps", a)
+		}
+
+		// last write wins, and the store keeps its own bookkeeping
+		if err := repo.Set(item{ID: "a", Title: "renamed", Version: 42}); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		a2, _ := repo.Get("a")
+		if a2.Title != "renamed" || a2.Version != 2 || !a2.CreatedAt.Equal(a.CreatedAt) {
+			t.Fatalf("after overwrite Get(a) = %+v; want title renamed, version 2, createdAt kept", a2)
+		}
+
+		if got := ids(repo.GetAll()); !slices.Equal(got, []string{"a", "b"}) {
+			t.Fatalf("GetAll = %v; want [a b]", got)
+		}
+
+		if err := repo.Delete("a"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, ok := repo.Get("a"); ok {
+			t.Fatal("Get found a deleted task")
+		}
+		if err := repo.Delete("a"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Delete of an unknown ID = %v; want ErrNotFound", err)
+		}
+		if got := ids(repo.GetAll()); !slices.Equal(got, []string{"b"}) {
+			t.Fatalf("GetAll = %v; want [b]", got)
+		}
+	})
+}
+
+func TestRepositoryByTag(t *testing.T) {
+	eachBackend(t, func(t *testing.T, _ backend, _ string, repo repository) {
+		repo.Set(item{ID: "a", Title: "a", Tags: []string{"x", "y"}})
+		repo.Set(item{ID: "b", Title: "b", Tags: []string{"y"}})
+
+		if got := ids(repo.ByTag("y")); !slices.Equal(got, []string{"a", "b"}) {
+			t.Fatalf("ByTag(y) = %v; want [a b]", got)
+		}
+		repo.Set(item{ID: "a", Title: "a", Tags: []string{"z"}}) // retag
+		if got := ids(repo.ByTag("y")); !slices.Equal(got, []string{"b"}) {
+			t.Fatalf("after retag ByTag(y) = %v; want [b]", got)
+		}
+		if got := ids(repo.ByTag("x")); len(got) != 0 {
+			t.Fatalf("after retag ByTag(x) = %v; want none", got)
+		}
+		repo.Delete("b")
+		if got := ids(repo.ByTag("y")); len(got) != 0 {
+			t.Fatalf("after delete ByTag(y) = %v; want none", got)
+		}
+	})
+}
+
+func TestRepositoryCompareAndSwap(t *testing.T) {
+	eachBackend(t, func(t *testing.T, _ backend, _ string, repo repository) {
+		saved, err := repo.CompareAndSwap(item{ID: "a", Title: "v1"}, 0)
+		if err != nil || saved.Version != 1 {
+			t.Fatalf("create CAS = %+v, %v; want version 1", saved, err)
+		}
+		if _, err := repo.CompareAndSwap(item{ID: "a", Title: "dup"}, 0); !errors.Is(err, ErrVersionConflict) {
+			t.Fatalf("create CAS over an existing task = %v; want ErrVersionConflict", err)
+		}
+		if _, err := repo.CompareAndSwap(item{ID: "a", Title: "stale"}, 7); !errors.Is(err, ErrVersionConflict) {
+			t.Fatalf("CAS at a stale version = %v; want ErrVersionConflict", err)
+		}
+		if _, err := repo.CompareAndSwap(item{ID: "missing", Title: "x"}, 1); !errors.Is(err, ErrVersionConflict) {
+			t.Fatalf("CAS on an unknown task at version 1 = %v; want ErrVersionConflict", err)
+		}
+
+		saved, err = repo.CompareAndSwap(item{ID: "a", Title: "v2"}, 1)
+		if err != nil || saved.Version != 2 || saved.Title != "v2" {
+			t.Fatalf("CAS at the current version = %+v, %v; want version 2", saved, err)
+		}
+		if got, _ := repo.Get("a"); got.Title != "v2" || got.Version != 2 {
+			t.Fatalf("Get after CAS = %+v; want what CAS returned", got)
+		}
+		if _, ok := repo.Get("missing"); ok {
+			t.Fatal("a failed CAS stored a task")
+		}
+	})
+}
+
+func TestRepositoryReopen(t *testing.T) {
+	eachBackend(t, func(t *testing.T, b backend, path string, repo repository) {
+		if !b.disk {
+			t.Skip("not persistent")
+		}
+		repo.Set(item{ID: "a", Title: "a", Tags: []string{"x"}})
+		repo.Set(item{ID: "b", Title: "b"})
+		repo.CompareAndSwap(item{ID: "a", Title: "a2", Tags: []string{"x"}}, 1)
+		repo.Delete("b")
+		want, _ := repo.Get("a")
+		if err := repo.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+
+		reopened, err := b.open(path)
+		if err != nil {
+			t.Fatalf("reopen: %v", err)
+		}
+		defer reopened.Close()
+		if got := ids(reopened.GetAll()); !slices.Equal(got, []string{"a"}) {
+			t.Fatalf("after reopen GetAll = %v; want [a]", got)
+		}
+		got, _ := reopened.Get("a")
+		if got.Title != want.Title || got.Version != want.Version || !got.UpdatedAt.Equal(want.UpdatedAt) {
+			t.Fatalf("after reopen Get(a) = %+v; want %+v", got, want)
+		}
+		if got := ids(reopened.ByTag("x")); !slices.Equal(got, []string{"a"}) {
+			t.Fatalf("after reopen ByTag(x) = %v; want [a]", got)
+		}
+		// versions carry on from where they were
+		if _, err := reopened.CompareAndSwap(item{ID: "a", Title: "a3"}, want.Version); err != nil {
+			t.Fatalf("CAS after reopen: %v", err)
+		}
+	})
+}
+
+func TestLogTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.log")
+	repo, err := OpenLog[item](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.Set(item{ID: "a", Title: "a"})
+	repo.Close()
+
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`{"op":"set","task":{"id":"b"`) // crash mid-append
+	f.Close()
+
+	repo, err = OpenLog[item](path)
+	if err != nil {
+		t.Fatalf("reopen with a torn tail: %v", err)
+	}
+	if got := ids(repo.GetAll()); !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("GetAll = %v; want [a]", got)
+	}
+	if err := repo.Set(item{ID: "c", Title: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	repo.Close()
+	if repo, err = OpenLog[item](path); err != nil {
+		t.Fatalf("reopen after appending past a torn tail: %v", err)
+	}
+	defer repo.Close()
+	if got := ids(repo.GetAll()); !slices.Equal(got, []string{"a", "c"}) {
+		t.Fatalf("GetAll = %v; want [a c]", got)
+	}
+}
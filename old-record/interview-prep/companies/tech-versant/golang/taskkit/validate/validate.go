@@ -0,0 +1,373 @@
+// Package validate decodes and checks the request bodies of rest-api and
+// rest-api-concurrent, and reports what is wrong with them as RFC 7807
+// problem details.
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ─── VALIDATION ───
+//
+// Request structs declare their rules in a `validate` tag, checked in
+// order, first failure per field wins:
+//
+//	required        non-blank string / non-zero value
+//	min=N, max=N    length for strings and slices, value for numbers
+//	oneof=a|b|c     string must be one of the listed values
+//	duration        string, if set, is a positive time.Duration
+//	email           string looks like an address
+//	tags            every element is a valid tag (see NormalizeTags)
+//	readonly        set by the server; clients may not send it on create
+//
+// Field names in reports come from the json tag, so they match the body.
+
+// Error is one field-level problem, as in
+// golang/solutions/04-error-handling.go.
+type Error struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("validation error on %s: %s", e.Field, e.Message)
+}
+
+// Errors aggregates every problem found in one request.
+type Errors []*Error
+
+func (es Errors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Field + ": " + e.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (es *Errors) Add(field, msg string) {
+	*es = append(*es, &Error{Field: field, Message: msg})
+}
+
+// Err returns nil when nothing was added, so callers can return it as is.
+func (es Errors) Err() error {
+	if len(es) == 0 {
+		return nil
+	}
+	return es
+}
+
+// Prefixed copies es with every field nested under prefix.
+func (es Errors) Prefixed(prefix string) Errors {
+	out := make(Errors, len(es))
+	for i, e := range es {
+		out[i] = &Error{Field: prefix + "." + e.Field, Message: e.Message}
+	}
+	return out
+}
+
+// Struct checks v's `validate` tags. create enables the readonly rule;
+// updates may echo server-maintained fields back unchanged.
+func Struct(v any, create bool) Errors {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+	var errs Errors
+	for i := range rt.NumField() {
+		f := rt.Field(i)
+		tag := f.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			name, arg, _ := strings.Cut(rule, "=")
+			if msg := checkRule(name, arg, rv.Field(i), create); msg != "" {
+				errs.Add(JSONName(f), msg)
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func JSONName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
+
+func checkRule(rule, arg string, v reflect.Value, create bool) string {
+	switch rule {
+	case "readonly":
+		if create && !v.IsZero() {
+			return "is set by the server"
+		}
+	case "required":
+		if v.Kind() == reflect.String && strings.TrimSpace(v.String()) == "" || v.IsZero() {
+			return "is required"
+		}
+	case "min", "max":
+		n, _ := strconv.ParseInt(arg, 10, 64)
+		var got int64
+		unit := ""
+		switch v.Kind() {
+		case reflect.String:
+			got, unit = int64(utf8.RuneCountInString(v.String())), " characters"
+		case reflect.Slice, reflect.Map:
+			got, unit = int64(v.Len()), " items"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			got = v.Int()
+		default:
+			panic("validate: " + rule + " on " + v.Kind().String())
+		}
+		if rule == "min" && got < n {
+			return fmt.Sprintf("must be at least %d%s", n, unit)
+		}
+		if rule == "max" && got > n {
+			return fmt.Sprintf("must be at most %d%s", n, unit)
+		}
+	case "oneof":
+		allowed := strings.Split(arg, "|")
+		if !slices.Contains(allowed, v.String()) {
+			return "must be one of " + strings.Join(allowed, ", ")
+		}
+	case "duration":
+		if s := v.String(); s != "" {
+			if d, err := time.ParseDuration(s); err != nil || d <= 0 {
+				return `must be a positive duration like "30s"`
+			}
+		}
+	case "email":
+		if local, domain, ok := strings.Cut(v.String(), "@"); !ok || local == "" || domain == "" {
+			return "must be an email address"
+		}
+	case "tags":
+		for i := range v.Len() {
+			if !TagPattern.MatchString(v.Index(i).String()) {
+				return "each tag must be 1-32 characters of a-z, 0-9, -, _ or :"
+			}
+		}
+	default:
+		panic("validate: unknown rule " + rule)
+	}
+	return ""
+}
+
+var TagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_:-]{0,31}$`)
+
+// NormalizeTags lower-cases, trims, sorts and dedupes tags, so "Urgent"
+// and "urgent " are one tag in the index. Blank tags are kept for the
+// tags rule to report.
+func NormalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	out := make([]string, len(tags))
+	for i, tag := range tags {
+		out[i] = strings.ToLower(strings.TrimSpace(tag))
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+// ─── BODY DECODING ───
+
+var MaxBodyBytes = flag.Int64("max-body", 1<<20, "largest accepted request body in bytes")
+
+// ErrBodyTooLarge is reported as 413 by WriteDecodeError.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// DecodeJSON reads exactly one JSON value into dst, rejecting unknown
+// fields, trailing data and bodies over -max-body. Field-level problems
+// (unknown or mistyped fields) come back as Errors, listing every
+// unknown field, with dst still filled as far as possible so the caller
+// can add its rule checks to the same report (see WithRules).
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, *MaxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return ErrBodyTooLarge
+		}
+		return errors.New("could not read body")
+	}
+	return Decode(data, dst)
+}
+
+// Decode is DecodeJSON for a body already read, such as a JSON value
+// inside a WebSocket message.
+func Decode(data []byte, dst any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	var errs Errors
+	if err != nil && strings.HasPrefix(err.Error(), "json: unknown field ") {
+		// The strict decoder stops at the first one; report them all and
+		// decode the rest leniently.
+		errs = unknownFields(data, reflect.TypeOf(dst), "")
+		dec = json.NewDecoder(bytes.NewReader(data))
+		err = dec.Decode(dst)
+	}
+	if err != nil {
+		jerr := JSONError(err)
+		var terrs Errors
+		if !errors.As(jerr, &terrs) {
+			return jerr
+		}
+		errs = append(errs, terrs...)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("body must contain a single JSON value")
+	}
+	return errs.Err()
+}
+
+// unknownFields lists the keys of the JSON object data that no field of
+// t (a struct, possibly behind pointers) accepts, recursing into nested
+// structs. Matching is case-insensitive, like encoding/json.
+func unknownFields(data []byte, t reflect.Type, prefix string) Errors {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeFor[time.Time]() {
+		return nil
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(data, &obj) != nil {
+		return nil // not an object: the decoder reports the type error
+	}
+	fields := reflect.VisibleFields(t)
+	var errs Errors
+	for _, key := range slices.Sorted(maps.Keys(obj)) {
+		i := slices.IndexFunc(fields, func(f reflect.StructField) bool {
+			return f.IsExported() && f.Tag.Get("json") != "-" && strings.EqualFold(JSONName(f), key)
+		})
+		if i < 0 {
+			errs.Add(prefix+key, "unknown field")
+			continue
+		}
+		errs = append(errs, unknownFields(obj[key], fields[i].Type, prefix+key+".")...)
+	}
+	return errs
+}
+
+// WithRules merges a DecodeJSON result with the rule checks in check, so
+// one response lists every problem. Any other decode error wins as is.
+func WithRules(decodeErr error, check func() error) error {
+	var errs Errors
+	if decodeErr != nil && !errors.As(decodeErr, &errs) {
+		return decodeErr
+	}
+	err := check()
+	var rerrs Errors
+	if err != nil && !errors.As(err, &rerrs) {
+		return err
+	}
+	for _, e := range rerrs {
+		// a mistyped field usually also fails its rules; say it once
+		if !slices.ContainsFunc(errs, func(d *Error) bool { return d.Field == e.Field }) {
+			errs = append(errs, e)
+		}
+	}
+	return errs.Err()
+}
+
+// JSONError turns decoder errors into something a client can act on.
+func JSONError(err error) error {
+	var (
+		tooLarge  *http.MaxBytesError
+		syntax    *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		validErrs Errors
+	)
+	switch {
+	case errors.As(err, &tooLarge):
+		return ErrBodyTooLarge
+	case errors.As(err, &validErrs):
+		return validErrs
+	case errors.As(err, &syntax):
+		return fmt.Errorf("malformed JSON at byte %d", syntax.Offset)
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("body must be a JSON object")
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			return errors.New("body must be a JSON object")
+		}
+		return Errors{{Field: field, Message: "must be a " + jsonType(typeErr.Type)}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		return Errors{{Field: field, Message: "unknown field"}}
+	}
+	return errors.New("invalid json")
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return "RFC 3339 timestamp"
+	}
+	return "object"
+}
+
+// ─── PROBLEM DETAILS (RFC 7807) ───
+
+const ProblemValidation = "/problems/validation-error"
+
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Errors Errors `json:"errors,omitempty"` // extension member
+}
+
+func WriteProblem(w http.ResponseWriter, p Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// WriteDecodeError answers a DecodeJSON or validation failure: 413 for
+// oversized bodies, otherwise 400, listing every field error.
+func WriteDecodeError(w http.ResponseWriter, err error) {
+	var errs Errors
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		WriteProblem(w, Problem{Status: http.StatusRequestEntityTooLarge,
+			Detail: fmt.Sprintf("body exceeds %d bytes", *MaxBodyBytes)})
+	case errors.As(err, &errs):
+		WriteProblem(w, Problem{Type: ProblemValidation, Title: "Invalid request body",
+			Status: http.StatusBadRequest, Detail: errs.Error(), Errors: errs})
+	default:
+		WriteProblem(w, Problem{Status: http.StatusBadRequest, Detail: err.Error()})
+	}
+}